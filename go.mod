@@ -2,13 +2,15 @@ module github.com/moqsien/processes
 
 go 1.18
 
-require github.com/gogf/gf v1.16.9
+require (
+	github.com/fatih/color v1.12.0
+	github.com/gogf/gf v1.16.9
+)
 
 require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
 	github.com/clbanning/mxj v1.8.5-0.20200714211355-ff02cfb8ea28 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fatih/color v1.12.0 // indirect
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/go-sql-driver/mysql v1.6.0 // indirect
 	github.com/gomodule/redigo v1.8.5 // indirect
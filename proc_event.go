@@ -0,0 +1,68 @@
+package processes
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType 事件类型
+type EventType string
+
+const (
+	EventLogQuotaPruned   EventType = "LOG_QUOTA_PRUNED"   // 日志总量超出配额，删除了备份文件
+	EventLogQuotaExceeded EventType = "LOG_QUOTA_EXCEEDED" // 删除所有备份文件后，日志总量仍然超出配额
+	EventReloadSucceeded  EventType = "RELOAD_SUCCEEDED"   // 平滑重启成功，新进程已经替换原进程
+	EventReloadFailed     EventType = "RELOAD_FAILED"      // 平滑重启失败，新进程已停止，原进程继续运行
+)
+
+// Event 进程管理器产生的事件
+type Event struct {
+	Type    EventType              `json:"type"`
+	Name    string                 `json:"name"` // 相关的进程名称，与具体进程无关时为空
+	Time    time.Time              `json:"time"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// 事件的订阅者列表
+type eventBus struct {
+	lock     sync.RWMutex
+	nextID   int
+	handlers map[int]func(Event)
+}
+
+// Subscribe 订阅进程管理器的事件，handler在产生事件的goroutine中同步调用，不能阻塞，返回取消订阅的函数
+func (that *Manager) Subscribe(handler func(Event)) (cancel func()) {
+	bus := that.events
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	id := bus.nextID
+	bus.nextID++
+	bus.handlers[id] = handler
+	return func() {
+		bus.lock.Lock()
+		defer bus.lock.Unlock()
+		delete(bus.handlers, id)
+	}
+}
+
+// 发送事件给所有订阅者
+func (that *Manager) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	bus := that.events
+	bus.lock.RLock()
+	handlers := make([]func(Event), 0, len(bus.handlers))
+	for _, handler := range bus.handlers {
+		handlers = append(handlers, handler)
+	}
+	bus.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{handlers: make(map[int]func(Event))}
+}
@@ -0,0 +1,406 @@
+package processes
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+// 没有设置优先级时的默认值
+const defaultPriority = 999
+
+/*
+Group 进程组，组的成员可以是进程名称或者多实例的程序名称，
+启动时优先级小的组先启动，组内优先级小的进程先启动，停止时顺序相反
+*/
+type Group struct {
+	Name     string
+	Priority int
+	lock     sync.RWMutex
+	members  []string
+}
+
+// Members 获取组的成员名称(进程或者程序)
+func (that *Group) Members() []string {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	return append([]string(nil), that.members...)
+}
+
+// 添加组成员，重复添加时忽略
+func (that *Group) add(member string) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for _, m := range that.members {
+		if m == member {
+			return
+		}
+	}
+	that.members = append(that.members, member)
+}
+
+// 移除组成员
+func (that *Group) remove(member string) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for i, m := range that.members {
+		if m == member {
+			that.members = append(that.members[:i], that.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// NewGroup 创建进程组，members为进程名称或者程序名称，组已存在时修改优先级并添加成员
+func (that *Manager) NewGroup(name string, priority int, members ...string) (*Group, error) {
+	if len(name) == 0 || strings.ContainsAny(name, ":*") || strings.HasPrefix(name, selectorPrefix) {
+		return nil, gerror.Newf("进程组名称[%s]不合法", name)
+	}
+	that.lock.Lock()
+	group, found := that.groups[name]
+	if !found {
+		group = &Group{Name: name}
+		that.groups[name] = group
+	}
+	group.Priority = priority
+	that.lock.Unlock()
+
+	for _, member := range members {
+		group.add(member)
+		that.setProcGroup(member, name)
+	}
+	return group, nil
+}
+
+// 设置进程或者程序的所有实例所属的进程组
+func (that *Manager) setProcGroup(member string, group string) {
+	for _, name := range that.expandMember(member) {
+		if value, ok := that.Search(name); ok {
+			if proc, ok := value.(*ProcessPlus); ok {
+				proc.Group = group
+			}
+		}
+	}
+	if program, ok := that.GetProgram(member); ok {
+		program.template.Group = group
+	}
+}
+
+// 进程加入ProcGroup设置的进程组，进程组不存在时按默认优先级创建
+func (that *Manager) joinGroup(member string, group string) {
+	if len(group) == 0 {
+		return
+	}
+	that.lock.Lock()
+	g, found := that.groups[group]
+	if !found {
+		g = &Group{Name: group, Priority: defaultPriority}
+		that.groups[group] = g
+	}
+	that.lock.Unlock()
+	g.add(member)
+}
+
+// GetGroup 获取进程组
+func (that *Manager) GetGroup(name string) (*Group, bool) {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	group, found := that.groups[name]
+	return group, found
+}
+
+// RemoveGroup 移除进程组，不会移除和停止组内的进程
+func (that *Manager) RemoveGroup(name string) {
+	that.lock.Lock()
+	group, found := that.groups[name]
+	delete(that.groups, name)
+	that.lock.Unlock()
+	if found {
+		for _, member := range group.Members() {
+			that.setProcGroup(member, "")
+		}
+	}
+}
+
+// 把进程名称或者程序名称展开为进程名称
+func (that *Manager) expandMember(member string) []string {
+	if program, ok := that.GetProgram(member); ok {
+		return program.Names()
+	}
+	if _, ok := that.Search(member); ok {
+		return []string{member}
+	}
+	return nil
+}
+
+/*
+Resolve 把操作目标解析为进程名称列表：
+"*"表示所有进程；"组名:*"表示组内所有进程；"组名:进程名"表示组内的一个进程；
+以"@"开头的为标签选择器，如"@team=payments,tier!=canary"、"@env"，见Selector；
+其他为进程名称或者多实例的程序名称
+*/
+func (that *Manager) Resolve(target string) ([]string, error) {
+	if selector, ok := isSelector(target); ok {
+		return that.Select(selector)
+	}
+	if target == "*" {
+		names := that.Keys()
+		sort.Strings(names)
+		return names, nil
+	}
+	pos := strings.Index(target, ":")
+	if pos < 0 {
+		names := that.expandMember(target)
+		if len(names) == 0 {
+			return nil, gerror.Newf("没有找到进程[%s]", target)
+		}
+		return names, nil
+	}
+
+	groupName, procName := target[:pos], target[pos+1:]
+	group, found := that.GetGroup(groupName)
+	if !found {
+		return nil, gerror.Newf("没有找到进程组[%s]", groupName)
+	}
+	names := make([]string, 0)
+	for _, member := range group.Members() {
+		for _, name := range that.expandMember(member) {
+			if procName == "*" || procName == name || procName == member {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 && procName != "*" {
+		return nil, gerror.Newf("进程组[%s]中没有进程[%s]", groupName, procName)
+	}
+	return names, nil
+}
+
+// 解析多个操作目标，去掉重复的进程
+func (that *Manager) resolveAll(targets []string) ([]IProc, error) {
+	seen := make(map[string]bool)
+	procs := make([]IProc, 0)
+	for _, target := range targets {
+		names, err := that.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if proc, ok := that.SearchProc(name); ok {
+				procs = append(procs, proc)
+			}
+		}
+	}
+	return procs, nil
+}
+
+/*
+获取进程的优先级：所属进程组的优先级和进程自身的优先级，不属于任何组的进程，组优先级为自身的优先级；
+进程(或者它所属的程序)属于多个组时，使用其中最小的组优先级，即跟随最先启动的组一起启动
+*/
+func (that *Manager) priorityOf(proc IProc) (int, int) {
+	p, ok := proc.(*ProcessPlus)
+	if !ok {
+		return defaultPriority, defaultPriority
+	}
+	that.lock.RLock()
+	groups := make([]*Group, 0, len(that.groups))
+	for _, group := range that.groups {
+		groups = append(groups, group)
+	}
+	that.lock.RUnlock()
+
+	priority, found := 0, false
+	for _, group := range groups {
+		for _, member := range group.Members() {
+			if member != p.Name && (len(p.Program) == 0 || member != p.Program) {
+				continue
+			}
+			if !found || group.Priority < priority {
+				priority, found = group.Priority, true
+			}
+			break
+		}
+	}
+	if found {
+		return priority, p.Priority
+	}
+	return p.Priority, p.Priority
+}
+
+// 按优先级把进程分为多批，同一批的进程优先级相同，reverse表示优先级大的先执行
+func (that *Manager) priorityBands(procs []IProc, reverse bool) [][]IProc {
+	type item struct {
+		proc        IProc
+		group, self int
+	}
+	items := make([]item, 0, len(procs))
+	for _, proc := range procs {
+		g, s := that.priorityOf(proc)
+		items = append(items, item{proc: proc, group: g, self: s})
+	}
+	less := func(a, b item) bool {
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		return a.self < b.self
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if reverse {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+	bands := make([][]IProc, 0)
+	for i, it := range items {
+		if i == 0 || less(items[i-1], it) || less(it, items[i-1]) {
+			bands = append(bands, make([]IProc, 0))
+		}
+		bands[len(bands)-1] = append(bands[len(bands)-1], it.proc)
+	}
+	return bands
+}
+
+/*
+按优先级分批对进程执行操作，同一批的进程并发执行，一批全部完成后才执行下一批，fn需要等待操作完成；
+wait为false时在后台按顺序执行各批并立即返回，优先级的顺序仍然保证
+*/
+func (that *Manager) runBands(bands [][]IProc, wait bool, fn func(IProc)) {
+	run := func() {
+		for _, band := range bands {
+			var wg sync.WaitGroup
+			for _, proc := range band {
+				wg.Add(1)
+				go func(p IProc) {
+					defer wg.Done()
+					fn(p)
+				}(proc)
+			}
+			wg.Wait()
+		}
+	}
+	if wait {
+		run()
+		return
+	}
+	go run()
+}
+
+// StartProcs 按优先级启动目标进程，targets的格式见Resolve，wait为false时立即返回，进程在后台按优先级依次启动
+func (that *Manager) StartProcs(wait bool, targets ...string) error {
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return err
+	}
+	that.runBands(that.priorityBands(procs, false), wait, func(p IProc) {
+		p.StartProc(true)
+	})
+	return nil
+}
+
+// StopProcs 按优先级的相反顺序停止目标进程，targets的格式见Resolve，wait为false时立即返回，进程在后台依次停止
+func (that *Manager) StopProcs(wait bool, targets ...string) error {
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return err
+	}
+	that.runBands(that.priorityBands(procs, true), wait, func(p IProc) {
+		p.StopProc(true)
+	})
+	return nil
+}
+
+// RestartProcs 先停止目标进程，再按优先级启动，targets的格式见Resolve
+func (that *Manager) RestartProcs(wait bool, targets ...string) error {
+	if err := that.StopProcs(true, targets...); err != nil {
+		return err
+	}
+	return that.StartProcs(wait, targets...)
+}
+
+// SignalProcs 向目标进程发送信号，targets的格式见Resolve
+func (that *Manager) SignalProcs(sig os.Signal, targets ...string) error {
+	type signaler interface {
+		Signal(sig os.Signal, sigChildren bool) error
+	}
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, proc := range procs {
+		if s, ok := proc.(signaler); ok {
+			if err := s.Signal(sig, false); err != nil {
+				logger.Errorf("发送信号[%v]失败：%v", sig, err)
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+// GetProcsInfo 获取目标进程的信息，targets的格式见Resolve
+func (that *Manager) GetProcsInfo(targets ...string) ([]*Info, error) {
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*Info, 0, len(procs))
+	for _, proc := range procs {
+		infos = append(infos, proc.GetProcessInfo())
+	}
+	return infos, nil
+}
+
+// StartGroup 按优先级启动进程组内的所有进程
+func (that *Manager) StartGroup(name string, wait bool) error {
+	return that.StartProcs(wait, name+":*")
+}
+
+// StopGroup 停止进程组内的所有进程
+func (that *Manager) StopGroup(name string, wait bool) error {
+	return that.StopProcs(wait, name+":*")
+}
+
+// RestartGroup 重启进程组内的所有进程
+func (that *Manager) RestartGroup(name string, wait bool) error {
+	return that.RestartProcs(wait, name+":*")
+}
+
+// SignalGroup 向进程组内的所有进程发送信号
+func (that *Manager) SignalGroup(name string, sig os.Signal) error {
+	return that.SignalProcs(sig, name+":*")
+}
+
+// GroupStatus 获取进程组内所有进程的信息
+func (that *Manager) GroupStatus(name string) ([]*Info, error) {
+	return that.GetProcsInfo(name + ":*")
+}
+
+// StartAllProcs 按进程组和进程的优先级启动所有设置了AutoStart的进程，按需启动的进程开始等待连接，wait为false时在后台依次启动
+func (that *Manager) StartAllProcs(wait bool) {
+	procs := make([]IProc, 0)
+	for _, proc := range that.GetAllProcs() {
+		if p, ok := proc.(*ProcessPlus); ok && p.OnDemand {
+			if err := that.armOnDemand(p); err != nil {
+				logger.Errorf("进程[%s]按需启动失败：%v", p.Name, err)
+			}
+			continue
+		}
+		if p, ok := proc.(*ProcessPlus); ok && !p.AutoStart {
+			continue
+		}
+		procs = append(procs, proc)
+	}
+	that.runBands(that.priorityBands(procs, false), wait, func(p IProc) {
+		p.StartProc(true)
+	})
+}
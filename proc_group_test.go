@@ -0,0 +1,86 @@
+package processes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriorityOfUsesLowestGroupPriority(t *testing.T) {
+	manager := NewManager()
+	a, _ := manager.NewProcess("a", ProcPath("/bin/true"))
+	b, _ := manager.NewProcess("b", ProcPath("/bin/true"))
+	_, _ = manager.NewGroup("late", 100, "a")
+	_, _ = manager.NewGroup("mid", 50, "b")
+	_, _ = manager.NewGroup("early", 1, "a")
+
+	if g, _ := manager.priorityOf(a); g != 1 {
+		t.Fatalf("进程a属于多个组时应该使用最小的组优先级1，得到%d", g)
+	}
+	bands := manager.priorityBands([]IProc{b, a}, false)
+	if len(bands) != 2 || bands[0][0] != IProc(a) || bands[1][0] != IProc(b) {
+		t.Fatalf("进程a应该先于进程b启动")
+	}
+}
+
+// 创建两个分别属于优先级1和100的进程组的进程
+func newOrderedGroups(t *testing.T) (*Manager, *ProcessPlus, *ProcessPlus) {
+	manager := NewManager()
+	opts := []Option{ProcPath("/bin/sleep"), ProcArgs([]string{"10"}), ProcAutoReStart(AutoReStartFalse), ProcStartSecs(1)}
+	a, err := manager.NewProcess("order-a", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := manager.NewProcess("order-b", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = manager.NewGroup("first", 1, "order-a")
+	_, _ = manager.NewGroup("second", 100, "order-b")
+	t.Cleanup(func() { _ = manager.StopProcs(true, "*") })
+	return manager, a, b
+}
+
+func procTimes(p *ProcessPlus) (time.Time, time.Time) {
+	p.Lock.RLock()
+	defer p.Lock.RUnlock()
+	return p.StartTime, p.StopTime
+}
+
+func TestGroupStartStopOrder(t *testing.T) {
+	manager, a, b := newOrderedGroups(t)
+	if err := manager.StartProcs(true, "*"); err != nil {
+		t.Fatal(err)
+	}
+	aStart, _ := procTimes(a)
+	bStart, _ := procTimes(b)
+	// 优先级小的组启动成功(startsecs为1秒)之后才启动下一个组
+	if bStart.Sub(aStart) < 900*time.Millisecond {
+		t.Fatalf("进程组second应该在first启动成功后启动，间隔%v", bStart.Sub(aStart))
+	}
+
+	if err := manager.StopProcs(true, "*"); err != nil {
+		t.Fatal(err)
+	}
+	_, aStop := procTimes(a)
+	_, bStop := procTimes(b)
+	if aStop.Before(bStop) {
+		t.Fatalf("停止时应该先停止优先级大的组，first停止于%v，second停止于%v", aStop, bStop)
+	}
+}
+
+func TestGroupStartOrderWithoutWait(t *testing.T) {
+	manager, a, b := newOrderedGroups(t)
+	begin := time.Now()
+	if err := manager.StartProcs(false, "*"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Fatalf("wait为false时应该立即返回，用时%v", elapsed)
+	}
+	waitProcState(t, b, Running)
+	aStart, _ := procTimes(a)
+	bStart, _ := procTimes(b)
+	if bStart.Sub(aStart) < 900*time.Millisecond {
+		t.Fatalf("wait为false时也应该按优先级依次启动，间隔%v", bStart.Sub(aStart))
+	}
+}
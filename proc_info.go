@@ -2,6 +2,7 @@ package processes
 
 import (
 	"fmt"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -11,57 +12,92 @@ import (
 
 // Info 进程的运行状态
 type Info struct {
-	Name          string `json:"name"`
-	Description   string `json:"description"`
-	Start         int    `json:"start"`
-	Stop          int    `json:"stop"`
-	Now           int    `json:"now"`
-	State         int    `json:"state"`
-	StateName     string `json:"statename"`
-	SpawnErr      string `json:"spawnerr"`
-	ExitStatus    int    `json:"exitstatus"`
-	Logfile       string `json:"logfile"`
-	StdoutLogfile string `json:"stdout_logfile"`
-	StderrLogfile string `json:"stderr_logfile"`
-	Pid           int    `json:"pid"`
+	Name            string            `json:"name"`
+	Group           string            `json:"group"`
+	Labels          map[string]string `json:"labels"`
+	Description     string            `json:"description"`
+	Start           int               `json:"start"`
+	Stop            int               `json:"stop"`
+	Now             int               `json:"now"`
+	State           int               `json:"state"`
+	StateName       string            `json:"statename"`
+	SpawnErr        string            `json:"spawnerr"`
+	ExitStatus      int               `json:"exitstatus"`
+	Logfile         string            `json:"logfile"`
+	StdoutLogfile   string            `json:"stdout_logfile"`
+	StderrLogfile   string            `json:"stderr_logfile"`
+	Pid             int               `json:"pid"`
+	Redactions      int64             `json:"redactions"`
+	SpoolRecords    int64             `json:"spool_records"`    // 远程日志暂存在磁盘队列中的记录数
+	SpoolBytes      int64             `json:"spool_bytes"`      // 远程日志暂存在磁盘队列中的字节数
+	LogDropped      int64             `json:"log_dropped"`      // 远程日志丢弃的记录数
+	SuppressedLines int64             `json:"suppressed_lines"` // 因为日志限流而丢弃的行数
+	SuppressedBytes int64             `json:"suppressed_bytes"` // 因为日志限流而丢弃的字节数
 }
 
 // GetProcessInfo 获取进程的详情
 func (that *ProcessPlus) GetProcessInfo() *Info {
+	spoolStats := that.LogSpoolStats()
+	suppressedLines, suppressedBytes := that.LogSuppressed()
 	return &Info{
-		Name:          that.Name,
-		Description:   that.GetDescription(),
-		Start:         int(that.StartTime.Unix()),
-		Stop:          int(that.StopTime.Unix()),
-		Now:           int(time.Now().Unix()),
-		State:         int(that.State),
-		StateName:     that.State.ToString(),
-		SpawnErr:      "",
-		ExitStatus:    that.GetExitStatus(),
-		Logfile:       that.GetStdoutLogfile(),
-		StdoutLogfile: that.GetStdoutLogfile(),
-		StderrLogfile: that.GetStderrLogfile(),
-		Pid:           that.Pid()}
+		Name:            that.Name,
+		Group:           that.Group,
+		Labels:          that.GetLabels(),
+		Description:     that.GetDescription(),
+		Start:           int(that.StartTime.Unix()),
+		Stop:            int(that.StopTime.Unix()),
+		Now:             int(time.Now().Unix()),
+		State:           int(that.State),
+		StateName:       that.State.ToString(),
+		SpawnErr:        "",
+		ExitStatus:      that.GetExitStatus(),
+		Logfile:         that.GetStdoutLogfile(),
+		StdoutLogfile:   that.GetStdoutLogfile(),
+		StderrLogfile:   that.GetStderrLogfile(),
+		Pid:             that.Pid(),
+		Redactions:      that.Redactions(),
+		SpoolRecords:    spoolStats.Records,
+		SpoolBytes:      spoolStats.Bytes,
+		LogDropped:      spoolStats.Dropped,
+		SuppressedLines: suppressedLines,
+		SuppressedBytes: suppressedBytes}
 
 }
 
+// GetLabels 获取进程的标签
+func (that *ProcessPlus) GetLabels() map[string]string {
+	if that.Labels == nil {
+		return map[string]string{}
+	}
+	return that.Labels.Map()
+}
+
 // GetDescription 获取进程描述
 func (that *ProcessPlus) GetDescription() string {
 	that.Lock.RLock()
 	defer that.Lock.RUnlock()
+	description := ""
 	if that.State == Running {
 		seconds := int(time.Now().Sub(that.StartTime).Seconds())
 		minutes := seconds / 60
 		hours := minutes / 60
 		days := hours / 24
 		if days > 0 {
-			return fmt.Sprintf("pid %d, uptime %d days, %d:%02d:%02d", that.Cmd.Process.Pid, days, hours%24, minutes%60, seconds%60)
+			description = fmt.Sprintf("pid %d, uptime %d days, %d:%02d:%02d", that.Pid(), days, hours%24, minutes%60, seconds%60)
+		} else {
+			description = fmt.Sprintf("pid %d, uptime %d:%02d:%02d", that.Pid(), hours%24, minutes%60, seconds%60)
 		}
-		return fmt.Sprintf("pid %d, uptime %d:%02d:%02d", that.Cmd.Process.Pid, hours%24, minutes%60, seconds%60)
 	} else if that.State != Stopped {
-		return gtime.New(that.StopTime).String()
+		description = gtime.New(that.StopTime).String()
+	}
+	// 进程通过sd_notify的STATUS=通知的状态文本
+	if len(that.notifyStatus) > 0 && that.State&Exist != 0 {
+		if len(description) > 0 {
+			description += ", "
+		}
+		description += that.notifyStatus
 	}
-	return ""
+	return description
 }
 
 // GetExitStatus 获取进程退出状态
@@ -87,18 +123,24 @@ func (that *ProcessPlus) GetStdoutLogfile() string {
 	if len(that.StdoutLogfile) > 0 {
 		fileName = that.StdoutLogfile
 	}
-	expandFile := gfile.RealPath(fileName)
-	return expandFile
+	return expandLogfile(fileName)
 }
 
 // GetStderrLogfile 获取标准错误将要写入的日志文件
 func (that *ProcessPlus) GetStderrLogfile() string {
 	fileName := "/dev/null"
 	if len(that.StderrLogfile) > 0 {
-		fileName = that.StdoutLogfile
+		fileName = that.StderrLogfile
 	}
-	expandFile := gfile.RealPath(fileName)
-	return expandFile
+	return expandLogfile(fileName)
+}
+
+// 展开日志文件的路径，文件还不存在时RealPath会返回空，此时使用原始的路径
+func expandLogfile(fileName string) string {
+	if expandFile := gfile.RealPath(fileName); len(expandFile) > 0 {
+		return expandFile
+	}
+	return fileName
 }
 
 // GetStatus 获取进程当前状态
@@ -111,8 +153,11 @@ func (that *ProcessPlus) GetStatus() string {
 
 // Pid 获取进程pid，返回0表示进程未启动
 func (that *ProcessPlus) Pid() int {
-	if (Failure & that.State) != 0 {
+	if (Failure&that.State) != 0 || that.Process == nil {
 		return 0
 	}
+	if pid := atomic.LoadInt32(&that.mainPid); pid > 0 {
+		return int(pid)
+	}
 	return that.Process.Pid
 }
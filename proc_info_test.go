@@ -0,0 +1,25 @@
+package processes
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetLogfiles(t *testing.T) {
+	dir := t.TempDir()
+	stdout, stderr := filepath.Join(dir, "out.log"), filepath.Join(dir, "err.log")
+	p, err := NewManager().NewProcess("logfiles-test",
+		ProcPath("/bin/sleep"),
+		ProcStdoutLog(stdout, ""),
+		ProcStderrLog(stderr, ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetStdoutLogfile(); got != stdout {
+		t.Fatalf("标准输出日志应该为%s，得到%s", stdout, got)
+	}
+	if got := p.GetStderrLogfile(); got != stderr {
+		t.Fatalf("标准错误日志应该为%s，得到%s", stderr, got)
+	}
+}
@@ -0,0 +1,226 @@
+package processes
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+// ListenerSpec 由管理器创建并持有的监听socket，启动进程时通过ExtraFiles传递给子进程
+type ListenerSpec struct {
+	Name    string // socket的名称，通过LISTEN_FDNAMES传递给子进程
+	Network string // tcp、tcp4、tcp6或者unix
+	Address string // 监听地址，如:8080、127.0.0.1:8080、/run/app.sock
+	Backlog int    // listen的backlog，0表示使用系统默认值SOMAXCONN
+}
+
+// 监听socket的唯一标识，相同地址的socket在多个进程(如平滑重启时的新旧进程)之间共享
+func (that *ListenerSpec) key() string {
+	return that.Network + "://" + that.Address
+}
+
+// 解析监听地址，支持tcp://:8080、unix:///run/app.sock，没有协议时以"/"开头的为unix，其他为tcp
+func parseListenAddress(address string) (network string, addr string, err error) {
+	if pos := strings.Index(address, "://"); pos >= 0 {
+		network, addr = address[:pos], address[pos+3:]
+	} else if strings.HasPrefix(address, "/") {
+		network, addr = "unix", address
+	} else {
+		network, addr = "tcp", address
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return "", "", gerror.Newf("不支持的监听协议[%s]", network)
+	}
+	if len(addr) == 0 {
+		return "", "", gerror.Newf("监听地址[%s]不合法", address)
+	}
+	return network, addr, nil
+}
+
+// 管理器持有的一个监听socket
+type managedListener struct {
+	spec  ListenerSpec
+	file  *os.File
+	users map[string]bool // 使用该socket的进程名称
+}
+
+// 创建监听socket，使用syscall以便设置backlog，返回的文件设置了close-on-exec，只会通过ExtraFiles传递给子进程
+func listenSocket(spec *ListenerSpec) (*os.File, error) {
+	backlog := spec.Backlog
+	if backlog <= 0 {
+		backlog = syscall.SOMAXCONN
+	}
+
+	var family int
+	var sa syscall.Sockaddr
+	if spec.Network == "unix" {
+		// 删除上次遗留的socket文件
+		if info, err := os.Lstat(spec.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(spec.Address)
+		}
+		family, sa = syscall.AF_UNIX, &syscall.SockaddrUnix{Name: spec.Address}
+	} else {
+		addr, err := net.ResolveTCPAddr(spec.Network, spec.Address)
+		if err != nil {
+			return nil, err
+		}
+		if ip4 := addr.IP.To4(); spec.Network == "tcp4" || (ip4 != nil && spec.Network != "tcp6") {
+			sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+			if ip4 != nil {
+				copy(sa4.Addr[:], ip4)
+			}
+			family, sa = syscall.AF_INET, sa4
+		} else {
+			sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+			if addr.IP != nil {
+				copy(sa6.Addr[:], addr.IP.To16())
+			}
+			family, sa = syscall.AF_INET6, sa6
+		}
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if family != syscall.AF_UNIX {
+		_ = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		if family == syscall.AF_INET6 && spec.Network == "tcp" {
+			_ = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0)
+		}
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err = syscall.Listen(fd, backlog); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("listen", err)
+	}
+	return os.NewFile(uintptr(fd), spec.Name), nil
+}
+
+/*
+获取进程需要的监听socket，已经存在的socket直接复用，不存在时创建；
+同名进程(平滑重启时的新旧进程)共享同一个socket，新进程在原进程停止前就可以接受连接
+*/
+func (that *Manager) acquireListeners(name string, specs []*ListenerSpec) ([]*os.File, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	files := make([]*os.File, 0, len(specs))
+	for _, spec := range specs {
+		l, found := that.listeners[spec.key()]
+		if !found {
+			file, err := listenSocket(spec)
+			if err != nil {
+				return nil, gerror.Wrapf(err, "进程[%s]监听[%s]失败", name, spec.key())
+			}
+			logger.Infof("为进程[%s]创建监听socket[%s]", name, spec.key())
+			l = &managedListener{spec: *spec, file: file, users: make(map[string]bool)}
+			that.listeners[spec.key()] = l
+		}
+		l.users[name] = true
+		files = append(files, l.file)
+	}
+	return files, nil
+}
+
+// 进程不再使用监听socket，没有进程使用的socket会被关闭
+func (that *Manager) releaseListeners(name string) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for key, l := range that.listeners {
+		if !l.users[name] {
+			continue
+		}
+		delete(l.users, name)
+		if len(l.users) == 0 {
+			l.close()
+			delete(that.listeners, key)
+		}
+	}
+}
+
+// 关闭监听socket，unix socket同时删除socket文件
+func (that *managedListener) close() {
+	_ = that.file.Close()
+	if that.spec.Network == "unix" {
+		_ = os.Remove(that.spec.Address)
+	}
+	logger.Infof("关闭监听socket[%s]", that.spec.key())
+}
+
+// CloseListeners 关闭管理器持有的所有监听socket，一般在停止所有进程之后调用，已经启动的子进程持有的副本不受影响
+func (that *Manager) CloseListeners() {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for key, l := range that.listeners {
+		l.close()
+		delete(that.listeners, key)
+	}
+}
+
+// 添加监听socket之前的启动命令，重新启动和克隆时使用
+type launchCmd struct {
+	path  string
+	args  []string
+	files []*os.File
+}
+
+// 获取没有添加监听socket的启动命令
+func (that *ProcessPlus) command() (string, []string, []*os.File) {
+	if that.launch != nil {
+		return that.launch.path, that.launch.args, that.launch.files
+	}
+	return that.Path, that.Args, that.ExtraFiles
+}
+
+// 恢复添加监听socket之前的启动命令
+func (that *ProcessPlus) restoreLaunch() {
+	if that.launch == nil {
+		return
+	}
+	that.Path, that.Args, that.ExtraFiles = that.command()
+	that.launch = nil
+}
+
+/*
+把管理器持有的监听socket传递给子进程：socket放在ExtraFiles的最前面，从fd 3开始，之后是ProcExtraFiles设置的文件，
+并按systemd的约定设置LISTEN_FDS和LISTEN_FDNAMES；LISTEN_PID需要等于子进程的pid，通过sh设置后再exec启动命令
+*/
+func (that *ProcessPlus) applyListeners() error {
+	if len(that.Listeners) == 0 {
+		return nil
+	}
+	if that.ProcManager == nil {
+		return gerror.Newf("进程[%s]没有加入进程管理器，不能创建监听socket", that.Name)
+	}
+	files, err := that.ProcManager.acquireListeners(that.Name, that.Listeners)
+	if err != nil {
+		return err
+	}
+
+	path, args, extraFiles := that.command()
+	that.launch = &launchCmd{path: path, args: args, files: extraFiles}
+	that.ExtraFiles = append(files, extraFiles...)
+	names := make([]string, 0, len(that.Listeners))
+	for _, spec := range that.Listeners {
+		names = append(names, spec.Name)
+	}
+	that.Env = append(that.Env, "LISTEN_FDS="+strconv.Itoa(len(files)), "LISTEN_FDNAMES="+strings.Join(names, ":"))
+
+	// sh的$$是自身的pid，exec之后pid不变
+	that.Path = "/bin/sh"
+	that.Args = []string{"sh", "-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$0" "$@"`, path}
+	if len(args) > 1 {
+		that.Args = append(that.Args, args[1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package processes
+
+import (
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	cases := []struct {
+		address string
+		network string
+		addr    string
+	}{
+		{"tcp://:8080", "tcp", ":8080"},
+		{"tcp6://[::1]:8080", "tcp6", "[::1]:8080"},
+		{"unix:///run/a.sock", "unix", "/run/a.sock"},
+		{"/run/a.sock", "unix", "/run/a.sock"},
+		{":8080", "tcp", ":8080"},
+		{"127.0.0.1:8080", "tcp", "127.0.0.1:8080"},
+	}
+	for _, c := range cases {
+		network, addr, err := parseListenAddress(c.address)
+		if err != nil || network != c.network || addr != c.addr {
+			t.Fatalf("解析%q应该得到%s %s，得到%s %s, %v", c.address, c.network, c.addr, network, addr, err)
+		}
+	}
+	for _, address := range []string{"udp://:53", "http://:80", "tcp://", "unix://", ""} {
+		if _, _, err := parseListenAddress(address); err == nil {
+			t.Fatalf("监听地址%q不合法，应该返回错误", address)
+		}
+	}
+}
@@ -1,23 +1,432 @@
 package processes
 
-import "github.com/moqsien/processes/proclog"
+import (
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+	"github.com/moqsien/processes/proclog"
+	"github.com/moqsien/processes/utils"
+)
 
 // 创建标准输出日志
 func (that *ProcessPlus) CreateStdoutLogger() proclog.Logger {
+	return proclog.NewFilterLogger(that.buildLogger(LogStreamStdout), that.logFilters(LogStreamStdout)...)
+}
+
+// 创建标准错误日志
+func (that *ProcessPlus) CreateStderrLogger() proclog.Logger {
+	return proclog.NewFilterLogger(that.buildLogger(LogStreamStderr), that.logFilters(LogStreamStderr)...)
+}
+
+// 按配置创建日志流的所有日志输出，管理器开启了控制台输出时，同时输出到控制台
+func (that *ProcessPlus) buildLogger(stream string) proclog.Logger {
 	logFile := that.GetStdoutLogfile()
 	maxBytes := int64(that.StdoutLogFileMaxBytes)
 	backups := that.StdoutLogFileBackups
+	if stream == LogStreamStderr {
+		logFile = that.GetStderrLogfile()
+		maxBytes = int64(that.StderrLogFileMaxBytes)
+		backups = that.StderrLogFileBackups
+	}
 
-	props := make(map[string]string)
-	return proclog.NewLogger(that.Name, logFile, proclog.NewNullLocker(), maxBytes, backups, props)
+	props := that.logProps(stream)
+	lg := proclog.NewLogger(that.Name, logFile, proclog.NewNullLocker(), maxBytes, backups, props)
+	that.recordSinks(stream, lg)
+	if that.ProcManager != nil {
+		if console := that.ProcManager.ConsoleSink(); console != nil {
+			lg = proclog.NewCompositeLogger([]proclog.Logger{lg, console.NewLogger(that.Name, stream)})
+		}
+	}
+	return lg
 }
 
-// 创建标准错误日志
-func (that *ProcessPlus) CreateStderrLogger() proclog.Logger {
-	logFile := that.GetStderrLogfile()
-	maxBytes := int64(that.StderrLogFileMaxBytes)
-	backups := that.StderrLogFileBackups
+// 记录每个配置的日志输出对应的日志对象，用于运行时移除日志输出
+func (that *ProcessPlus) recordSinks(stream string, lg proclog.Logger) {
+	if that.logSinks == nil {
+		that.logSinks = make(map[string]proclog.Logger)
+	}
+	for key := range that.logSinks {
+		if strings.HasPrefix(key, stream+"|") {
+			delete(that.logSinks, key)
+		}
+	}
+	composite, ok := lg.(*proclog.CompositeLogger)
+	if !ok {
+		return
+	}
+	// NewLogger按配置的顺序创建日志对象
+	files := proclog.SplitFileNames(*that.logfiles(stream))
+	loggers := composite.Loggers()
+	if len(files) != len(loggers) {
+		return
+	}
+	for i, f := range files {
+		that.logSinks[stream+"|"+f] = loggers[i]
+	}
+}
+
+// 创建日志对象的参数，stream为日志流的名称
+func (that *ProcessPlus) logProps(stream string) map[string]string {
+	props := map[string]string{"stream": stream}
+	if that.LogTimestamp {
+		props["timestamp"] = "true"
+	}
+	if that.LogFileMode != 0 {
+		props["file_mode"] = strconv.FormatUint(uint64(that.LogFileMode.Perm()), 8)
+	}
+	if that.LogDirMode != 0 {
+		props["dir_mode"] = strconv.FormatUint(uint64(that.LogDirMode.Perm()), 8)
+	}
+	if len(that.LogFileOwner) > 0 || len(that.LogFileGroup) > 0 {
+		uid, gid, err := lookupOwner(that.LogFileOwner, that.LogFileGroup)
+		if err != nil {
+			logger.Errorf("进程[%s]的日志文件所属用户[%s:%s]无效,err:%v", that.Name, that.LogFileOwner, that.LogFileGroup, err)
+		} else {
+			props["file_uid"] = strconv.Itoa(uid)
+			props["file_gid"] = strconv.Itoa(gid)
+		}
+	}
+	return props
+}
+
+// 查找用户和组的id，owner和group可以是名称或者数字id，为空时返回-1
+func lookupOwner(owner, group string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	if len(owner) > 0 {
+		u, e := user.Lookup(owner)
+		if e != nil {
+			if u, e = user.LookupId(owner); e != nil {
+				return -1, -1, e
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return -1, -1, err
+		}
+		if len(group) == 0 {
+			if gid, err = strconv.Atoi(u.Gid); err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+	if len(group) > 0 {
+		g, e := user.LookupGroup(group)
+		if e != nil {
+			if g, e = user.LookupGroupId(group); e != nil {
+				return -1, -1, e
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return -1, -1, err
+		}
+	}
+	return uid, gid, nil
+}
+
+// 日志写入前的过滤器链，stream为日志流的名称
+func (that *ProcessPlus) logFilters(stream string) []proclog.Filter {
+	filters := make([]proclog.Filter, 0)
+	if that.ReadyPattern != nil && that.ready != nil {
+		// 就绪规则放在最前面，匹配的是进程的原始输出，不受限流和脱敏的影响
+		gate, name := that.ready, that.Name
+		filters = append(filters, proclog.NewMatchFilter(that.ReadyPattern, func(line []byte) {
+			logger.Infof("进程[%s]的%s匹配就绪规则：%s", name, stream, line)
+			gate.open()
+		}))
+	}
+	if that.LogRateLimitLines > 0 || that.LogRateLimitBytes > 0 {
+		// 限流过滤器在进程的多次启动之间保留，以便统计该进程总的丢弃数
+		limiter := &that.stdoutLimiter
+		if stream == LogStreamStderr {
+			limiter = &that.stderrLimiter
+		}
+		if *limiter == nil {
+			*limiter = proclog.NewRateLimitFilter(that.LogRateLimitLines,
+				that.LogRateLimitBytes,
+				time.Duration(that.LogRateLimitInterval)*time.Second)
+		}
+		filters = append(filters, *limiter)
+	}
+	if that.LogRedactBuiltin || len(that.LogRedactRules) > 0 {
+		// 脱敏过滤器按行缓存，每个日志流单独一个，在进程的多次启动之间保留，以便统计该进程总的脱敏次数
+		redactor := &that.stdoutRedactor
+		if stream == LogStreamStderr {
+			redactor = &that.stderrRedactor
+		}
+		if *redactor == nil {
+			*redactor = proclog.NewRedactFilter(that.LogRedactBuiltin, that.LogRedactRules...)
+		}
+		filters = append(filters, *redactor)
+	}
+	return filters
+}
+
+// Redactions 获取进程日志的脱敏次数
+func (that *ProcessPlus) Redactions() (count int64) {
+	for _, redactor := range []*proclog.RedactFilter{that.stdoutRedactor, that.stderrRedactor} {
+		if redactor != nil {
+			count += redactor.Count()
+		}
+	}
+	return
+}
+
+// LogSuppressed 获取进程日志因为限流而丢弃的行数和字节数，包括标准输出和标准错误
+func (that *ProcessPlus) LogSuppressed() (lines int64, bytes int64) {
+	for _, limiter := range []*proclog.RateLimitFilter{that.stdoutLimiter, that.stderrLimiter} {
+		if limiter != nil {
+			l, b := limiter.Suppressed()
+			lines += l
+			bytes += b
+		}
+	}
+	return
+}
+
+// StdoutLogReader 获取标准输出日志的读取对象，可以跨备份文件读取日志
+func (that *ProcessPlus) StdoutLogReader() (*proclog.RotatedReader, error) {
+	return logReader(that.StdoutLog)
+}
+
+// StderrLogReader 获取标准错误日志的读取对象，可以跨备份文件读取日志
+func (that *ProcessPlus) StderrLogReader() (*proclog.RotatedReader, error) {
+	return logReader(that.StderrLog)
+}
+
+func logReader(lg proclog.Logger) (*proclog.RotatedReader, error) {
+	fileLogger := proclog.FindFileLogger(lg)
+	if fileLogger == nil {
+		return nil, gerror.New("NO_FILE")
+	}
+	return fileLogger.Reader(), nil
+}
+
+// LogSpoolStats 获取进程远程日志的暂存状态，汇总标准输出和标准错误的所有远程日志
+func (that *ProcessPlus) LogSpoolStats() proclog.SpoolStats {
+	stats := proclog.SpoolStats{Connected: true}
+	collect := func(l proclog.Logger) bool {
+		if reporter, ok := l.(proclog.SpoolReporter); ok {
+			s := reporter.SpoolStats()
+			stats.Connected = stats.Connected && s.Connected
+			stats.Records += s.Records
+			stats.Bytes += s.Bytes
+			stats.Dropped += s.Dropped
+		}
+		return true
+	}
+	proclog.Walk(that.StdoutLog, collect)
+	if that.StderrLog != that.StdoutLog {
+		proclog.Walk(that.StderrLog, collect)
+	}
+	return stats
+}
+
+// 获取正在运行的进程的日志对象，进程没有运行时返回nil，调用方需要持有that.Lock
+func (that *ProcessPlus) liveLogger(stream string) *proclog.FilterLogger {
+	if !that.IsRunning() {
+		return nil
+	}
+	lg := that.StdoutLog
+	if stream == LogStreamStderr {
+		lg = that.StderrLog
+	}
+	filterLogger, _ := lg.(*proclog.FilterLogger)
+	return filterLogger
+}
+
+// 检查日志流的名称，stderr重定向到stdout时不能单独修改stderr的日志
+func (that *ProcessPlus) checkLogStream(stream string) error {
+	switch stream {
+	case LogStreamStdout:
+		return nil
+	case LogStreamStderr:
+		if that.RedirectStderr {
+			return gerror.Newf("进程[%s]的标准错误已经重定向到标准输出", that.Name)
+		}
+		return nil
+	}
+	return gerror.Newf("不支持的日志流[%s]", stream)
+}
+
+// 获取日志流配置的日志输出列表
+func (that *ProcessPlus) logfiles(stream string) *string {
+	if stream == LogStreamStderr {
+		return &that.StderrLogfile
+	}
+	return &that.StdoutLogfile
+}
+
+/*
+SetLogfile 运行时替换日志流的所有日志输出，file的格式与ProcStdoutLog相同，
+进程正在运行时新的日志对象会原子地替换旧的日志对象，替换前的输出全部写入旧的日志，之后的输出全部写入新的日志，
+同时修改进程的配置，进程重启后继续使用新的日志；没有指定backups时保留原来的备份数量
+*/
+func (that *ProcessPlus) SetLogfile(stream string, file, maxBytes string, backups ...int) error {
+	if err := that.checkLogStream(stream); err != nil {
+		return err
+	}
+	that.Lock.Lock()
+	if stream == LogStreamStderr {
+		that.StderrLogfile = file
+		that.StderrLogFileMaxBytes = utils.GetBytes(maxBytes, 50*1024*1024)
+		if len(backups) > 0 {
+			that.StderrLogFileBackups = backups[0]
+		}
+	} else {
+		that.StdoutLogfile = file
+		that.StdoutLogFileMaxBytes = utils.GetBytes(maxBytes, 50*1024*1024)
+		if len(backups) > 0 {
+			that.StdoutLogFileBackups = backups[0]
+		}
+	}
+	var oldLogger proclog.Logger
+	if live := that.liveLogger(stream); live != nil {
+		oldLogger = live.SetLogger(that.buildLogger(stream))
+	}
+	that.Lock.Unlock()
+
+	// 旧的日志对象在替换之后关闭，远程日志可能需要一段时间发送剩余的内容
+	if oldLogger != nil {
+		return oldLogger.Close()
+	}
+	return nil
+}
+
+// AddLogSink 运行时给日志流添加一个日志输出，file为日志输出的URL，如syslog://127.0.0.1:514、tcp://host:port
+func (that *ProcessPlus) AddLogSink(stream string, file string) error {
+	if err := that.checkLogStream(stream); err != nil {
+		return err
+	}
+	file = strings.TrimSpace(file)
+	if len(file) == 0 {
+		return gerror.New("日志输出不能为空")
+	}
+	if _, err := proclog.ParseLogURL(file); err != nil {
+		return err
+	}
+	that.Lock.Lock()
+	defer that.Lock.Unlock()
+
+	logfiles := that.logfiles(stream)
+	for _, f := range proclog.SplitFileNames(*logfiles) {
+		if f == file {
+			return gerror.Newf("进程[%s]已经存在日志输出[%s]", that.Name, file)
+		}
+	}
+	if len(*logfiles) == 0 {
+		*logfiles = file
+	} else {
+		*logfiles += "," + file
+	}
+	if live := that.liveLogger(stream); live != nil {
+		maxBytes, backups := int64(that.StdoutLogFileMaxBytes), that.StdoutLogFileBackups
+		if stream == LogStreamStderr {
+			maxBytes, backups = int64(that.StderrLogFileMaxBytes), that.StderrLogFileBackups
+		}
+		lg := proclog.CreateLogger(that.Name, expandLogfile(file), proclog.NewNullLocker(),
+			maxBytes, backups, that.logProps(stream))
+		live.AddLogger(lg)
+		that.logSinks[stream+"|"+file] = lg
+	}
+	return nil
+}
+
+// RemoveLogSink 运行时移除日志流的一个日志输出，被移除的日志输出会在移除之后关闭
+func (that *ProcessPlus) RemoveLogSink(stream string, file string) error {
+	if err := that.checkLogStream(stream); err != nil {
+		return err
+	}
+	file = strings.TrimSpace(file)
+	that.Lock.Lock()
+	logfiles := that.logfiles(stream)
+	files := proclog.SplitFileNames(*logfiles)
+	index := -1
+	for i, f := range files {
+		if f == file {
+			index = i
+			break
+		}
+	}
+	if len(*logfiles) == 0 || index < 0 {
+		that.Lock.Unlock()
+		return gerror.Newf("进程[%s]没有日志输出[%s]", that.Name, file)
+	}
+	*logfiles = strings.Join(append(files[:index], files[index+1:]...), ",")
+
+	var removed proclog.Logger
+	if live := that.liveLogger(stream); live != nil {
+		if lg, ok := that.logSinks[stream+"|"+file]; ok && live.RemoveLogger(lg) {
+			removed = lg
+		}
+	}
+	delete(that.logSinks, stream+"|"+file)
+	that.Lock.Unlock()
+
+	if removed != nil {
+		return removed.Close()
+	}
+	return nil
+}
+
+// ReopenLogs 重新打开进程的所有日志文件，用于配合外部的logrotate
+func (that *ProcessPlus) ReopenLogs() error {
+	var err error
+	reopen := func(l proclog.Logger) bool {
+		if fileLogger, ok := l.(*proclog.FileLogger); ok {
+			if e := fileLogger.Reopen(); e != nil && err == nil {
+				err = e
+			}
+		}
+		return true
+	}
+	that.Lock.RLock()
+	stdoutLog, stderrLog := that.StdoutLog, that.StderrLog
+	that.Lock.RUnlock()
+	proclog.Walk(stdoutLog, reopen)
+	if stderrLog != stdoutLog {
+		proclog.Walk(stderrLog, reopen)
+	}
+	return err
+}
+
+// LogFiles 获取进程写入本地文件的日志路径，包括标准输出和标准错误，不包括备份文件
+func (that *ProcessPlus) LogFiles() []string {
+	that.Lock.RLock()
+	defer that.Lock.RUnlock()
+	files := proclog.LogFilePaths(that.GetStdoutLogfile())
+	if !that.RedirectStderr {
+		files = append(files, proclog.LogFilePaths(that.GetStderrLogfile())...)
+	}
+	return files
+}
+
+// 删除日志文件name的备份文件，日志对象存在时持有它的锁，避免与日志的滚动同时进行
+func (that *ProcessPlus) removeLogBackup(name string, backup string) error {
+	that.Lock.RLock()
+	loggers := []proclog.Logger{that.StdoutLog, that.StderrLog}
+	backups := that.StdoutLogFileBackups
+	for _, path := range proclog.LogFilePaths(that.GetStderrLogfile()) {
+		if path == name && !that.RedirectStderr {
+			backups = that.StderrLogFileBackups
+		}
+	}
+	that.Lock.RUnlock()
 
-	props := make(map[string]string)
-	return proclog.NewLogger(that.Name, logFile, proclog.NewNullLocker(), maxBytes, backups, props)
+	var fileLogger *proclog.FileLogger
+	for _, lg := range loggers {
+		proclog.Walk(lg, func(l proclog.Logger) bool {
+			if f, ok := l.(*proclog.FileLogger); ok && f.Name() == name {
+				fileLogger = f
+				return false
+			}
+			return true
+		})
+		if fileLogger != nil {
+			return fileLogger.RemoveBackupFile(backup)
+		}
+	}
+	return proclog.RemoveBackupFile(name, backups, backup)
 }
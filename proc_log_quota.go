@@ -0,0 +1,218 @@
+package processes
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moqsien/processes/logger"
+	"github.com/moqsien/processes/proclog"
+	"github.com/moqsien/processes/utils"
+)
+
+// 默认的日志配额检查间隔
+const defaultLogQuotaInterval = 60 * time.Second
+
+// LogUsage 所有进程的日志文件(包括备份)占用的磁盘空间
+type LogUsage struct {
+	Total  int64            `json:"total"`  // 总字节数
+	Quota  int64            `json:"quota"`  // 配额，0表示不限制
+	Procs  map[string]int64 `json:"procs"`  // 每个进程的日志字节数
+	Pruned []string         `json:"pruned"` // 本次检查删除的备份文件
+}
+
+// 日志配额的设置和后台检查的goroutine
+type logQuota struct {
+	lock     sync.Mutex
+	maxBytes int64
+	stop     chan struct{}
+}
+
+// 一个日志文件
+type quotaFile struct {
+	path    string
+	logName string // 备份文件所属的日志文件
+	size    int64
+	modTime time.Time
+}
+
+// 一个进程的日志文件，backups按从旧到新的顺序排列
+type quotaProc struct {
+	name    string
+	owner   logFilesOwner
+	backups []*quotaFile
+}
+
+// 有日志文件的进程
+type logFilesOwner interface {
+	LogFiles() []string
+	removeLogBackup(name string, backup string) error
+}
+
+/*
+SetLogQuota 设置所有进程的日志文件(包括备份)的总容量，支持KB、MB、GB后缀，为空或者0表示不限制，
+每隔intervalSecs秒(默认60秒)检查一次，超出配额时从最旧的备份文件开始删除，并且在进程之间轮流删除，
+当前正在写入的日志文件不会被删除
+*/
+func (that *Manager) SetLogQuota(maxBytes string, intervalSecs ...int) {
+	interval := defaultLogQuotaInterval
+	if len(intervalSecs) > 0 && intervalSecs[0] > 0 {
+		interval = time.Duration(intervalSecs[0]) * time.Second
+	}
+	quota := that.quota
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+
+	if quota.stop != nil {
+		close(quota.stop)
+		quota.stop = nil
+	}
+	quota.maxBytes = int64(utils.GetBytes(maxBytes, 0))
+	if quota.maxBytes <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	quota.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = that.EnforceLogQuota()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// LogUsage 统计所有进程的日志文件(包括备份)占用的磁盘空间
+func (that *Manager) LogUsage() *LogUsage {
+	usage, _ := that.scanLogFiles()
+	return usage
+}
+
+// 统计所有进程的日志文件，同一个文件只统计一次
+func (that *Manager) scanLogFiles() (*LogUsage, []*quotaProc) {
+	that.quota.lock.Lock()
+	usage := &LogUsage{Quota: that.quota.maxBytes, Procs: make(map[string]int64)}
+	that.quota.lock.Unlock()
+
+	seen := make(map[string]bool)
+	stat := func(path string) *quotaFile {
+		if seen[path] {
+			return nil
+		}
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		return &quotaFile{path: path, size: info.Size(), modTime: info.ModTime()}
+	}
+
+	names := that.Keys()
+	sort.Strings(names)
+	procs := make([]*quotaProc, 0, len(names))
+	for _, name := range names {
+		proc, found := that.SearchProc(name)
+		if !found {
+			continue
+		}
+		owner, ok := proc.(logFilesOwner)
+		if !ok {
+			continue
+		}
+		qp := &quotaProc{name: name, owner: owner}
+		for _, path := range owner.LogFiles() {
+			if f := stat(path); f != nil {
+				usage.Procs[name] += f.size
+				usage.Total += f.size
+			}
+			for _, backup := range proclog.ListBackupFiles(path) {
+				if f := stat(backup); f != nil {
+					f.logName = path
+					usage.Procs[name] += f.size
+					usage.Total += f.size
+					qp.backups = append(qp.backups, f)
+				}
+			}
+		}
+		sort.Slice(qp.backups, func(i, j int) bool {
+			return qp.backups[i].modTime.Before(qp.backups[j].modTime)
+		})
+		procs = append(procs, qp)
+	}
+	return usage, procs
+}
+
+// EnforceLogQuota 立即检查一次日志配额，超出时删除备份文件，返回检查后的磁盘占用
+func (that *Manager) EnforceLogQuota() *LogUsage {
+	usage, procs := that.scanLogFiles()
+	if usage.Quota <= 0 || usage.Total <= usage.Quota {
+		return usage
+	}
+	before := usage.Total
+
+	// 每一轮从每个进程中取出最旧的一个备份文件，按时间从旧到新删除，直到不再超出配额
+	for usage.Total > usage.Quota {
+		round := make([]*quotaFile, 0, len(procs))
+		owners := make(map[*quotaFile]*quotaProc, len(procs))
+		for _, qp := range procs {
+			if len(qp.backups) > 0 {
+				round = append(round, qp.backups[0])
+				owners[qp.backups[0]] = qp
+				qp.backups = qp.backups[1:]
+			}
+		}
+		if len(round) == 0 {
+			break
+		}
+		sort.Slice(round, func(i, j int) bool {
+			return round[i].modTime.Before(round[j].modTime)
+		})
+		for _, f := range round {
+			if usage.Total <= usage.Quota {
+				break
+			}
+			// 通过进程删除，持有日志对象的锁并更新日志流的起始偏移
+			if err := owners[f].owner.removeLogBackup(f.logName, f.path); err != nil {
+				logger.Errorf("删除日志备份文件[%s]失败：%v", f.path, err)
+				continue
+			}
+			usage.Total -= f.size
+			usage.Procs[owners[f].name] -= f.size
+			usage.Pruned = append(usage.Pruned, f.path)
+		}
+	}
+
+	if len(usage.Pruned) > 0 {
+		message := fmt.Sprintf("日志总量%d字节超出配额%d字节，删除了%d个备份文件", before, usage.Quota, len(usage.Pruned))
+		logger.Info(message)
+		that.emit(Event{
+			Type:    EventLogQuotaPruned,
+			Message: message,
+			Data: map[string]interface{}{
+				"before": before,
+				"after":  usage.Total,
+				"quota":  usage.Quota,
+				"files":  usage.Pruned,
+			},
+		})
+	}
+	if usage.Total > usage.Quota {
+		that.emit(Event{
+			Type:    EventLogQuotaExceeded,
+			Message: fmt.Sprintf("删除所有备份文件后，日志总量%d字节仍然超出配额%d字节", usage.Total, usage.Quota),
+			Data: map[string]interface{}{
+				"usage": usage.Total,
+				"quota": usage.Quota,
+				"procs": usage.Procs,
+			},
+		})
+	}
+	return usage
+}
@@ -0,0 +1,63 @@
+package processes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnforceLogQuotaKeepsOffsets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "quota.log")
+	manager := NewManager()
+	p, err := manager.NewProcess("quota-test",
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10"}),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStdoutLog(name, "100", 5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.StartProc(true)
+	defer p.StopProc(true)
+	// 每行100字节，每次写入都会滚动，得到quota.log.1 ... quota.log.4
+	line := func(i int) string {
+		return fmt.Sprintf("line-%094d\n", i)
+	}
+	for i := 1; i <= 4; i++ {
+		writeStdout(p, line(i))
+	}
+	reader, err := p.StdoutLogReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := reader.ReadLog(300, 100); s != line(4) {
+		t.Fatalf("偏移300应该是第四行，得到%q", s)
+	}
+
+	var events []Event
+	manager.Subscribe(func(e Event) {
+		if e.Type == EventLogQuotaPruned {
+			events = append(events, e)
+		}
+	})
+	manager.SetLogQuota("250")
+	defer manager.SetLogQuota("")
+	usage := manager.EnforceLogQuota()
+	if len(usage.Pruned) != 2 || usage.Pruned[0] != name+".4" || usage.Pruned[1] != name+".3" {
+		t.Fatalf("应该从最旧的备份开始删除两个文件，得到%v", usage.Pruned)
+	}
+	if usage.Total != 200 {
+		t.Fatalf("删除后日志总量应该为200字节，得到%d", usage.Total)
+	}
+	if _, err = os.Stat(name + ".2"); err != nil {
+		t.Fatalf("较新的备份不应该被删除：%v", err)
+	}
+	if s, err := reader.ReadLog(300, 100); err != nil || s != line(4) {
+		t.Fatalf("删除备份后偏移不应该变化，得到%q, %v", s, err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("应该发送一个LOG_QUOTA_PRUNED事件，得到%d个", len(events))
+	}
+}
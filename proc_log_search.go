@@ -0,0 +1,241 @@
+package processes
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/proclog"
+)
+
+// 日志流名称
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// LogQuery 日志搜索条件
+type LogQuery struct {
+	Names      []string  // 要搜索的进程，支持进程名称、程序名称、"组名:*"和以"@"开头的标签选择器，为空表示所有进程
+	Selector   string    // 标签选择器(不带"@"前缀)，如team=payments,tier!=canary，与Names同时设置时取交集
+	Streams    []string  // 要搜索的日志流，可选值：[stdout,stderr]，为空表示全部
+	Pattern    string    // 搜索的内容
+	Regex      bool      // Pattern是否为正则表达式，默认为子串匹配
+	IgnoreCase bool      // 是否忽略大小写
+	Context    int       // 返回匹配行前后的上下文行数
+	MaxResults int       // 最多返回的结果数，默认100
+	Since      time.Time // 只搜索不早于该时间的日志，需要开启日志时间戳
+	Until      time.Time // 只搜索早于该时间的日志，需要开启日志时间戳
+}
+
+// LogMatch 日志搜索结果
+type LogMatch struct {
+	Name   string    `json:"name"`
+	Stream string    `json:"stream"`
+	Line   int64     `json:"line"`
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+	Before []string  `json:"before"`
+	After  []string  `json:"after"`
+}
+
+// 根据搜索条件生成匹配函数
+func (that *LogQuery) matcher() (func(string) bool, error) {
+	if len(that.Pattern) == 0 {
+		return nil, gerror.New("搜索内容不能为空")
+	}
+	if that.Regex {
+		pattern := that.Pattern
+		if that.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, gerror.Wrap(err, "搜索的正则表达式不合法")
+		}
+		return re.MatchString, nil
+	}
+	if that.IgnoreCase {
+		pattern := strings.ToLower(that.Pattern)
+		return func(s string) bool {
+			return strings.Contains(strings.ToLower(s), pattern)
+		}, nil
+	}
+	return func(s string) bool {
+		return strings.Contains(s, that.Pattern)
+	}, nil
+}
+
+func (that *LogQuery) hasStream(stream string) bool {
+	if len(that.Streams) == 0 {
+		return true
+	}
+	for _, s := range that.Streams {
+		if s == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// 包含日志读取能力的进程
+type logReaderProc interface {
+	StdoutLogReader() (*proclog.RotatedReader, error)
+	StderrLogReader() (*proclog.RotatedReader, error)
+}
+
+// 解析日志操作的目标进程，targets和selector都为空时返回所有进程
+func (that *Manager) resolveLogTargets(targets []string, selector string) ([]string, error) {
+	if len(targets) == 0 {
+		targets = []string{"*"}
+	}
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		resolved, err := that.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range resolved {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(selector) == 0 {
+		return names, nil
+	}
+	selected, err := that.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]string, 0, len(names))
+	for _, name := range names {
+		if i := sort.SearchStrings(selected, name); i < len(selected) && selected[i] == name {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered, nil
+}
+
+// SearchLogs 在一个或多个进程的日志(包括备份的日志文件)中搜索内容，ctx用于取消搜索
+// 搜索被取消时，返回已找到的结果和ctx的错误
+func (that *Manager) SearchLogs(ctx context.Context, query *LogQuery) ([]*LogMatch, error) {
+	match, err := query.matcher()
+	if err != nil {
+		return nil, err
+	}
+	limit := query.MaxResults
+	if limit <= 0 {
+		limit = 100
+	}
+
+	names, err := that.resolveLogTargets(query.Names, query.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*LogMatch, 0)
+	for _, name := range names {
+		proc, found := that.SearchProc(name)
+		if !found {
+			return results, gerror.Newf("没有找到进程[%s]", name)
+		}
+		p, ok := proc.(logReaderProc)
+		if !ok {
+			continue
+		}
+		var stdoutReader *proclog.RotatedReader
+		if query.hasStream(LogStreamStdout) {
+			if stdoutReader, err = p.StdoutLogReader(); err == nil {
+				results, err = searchReader(ctx, stdoutReader, match, query, name, LogStreamStdout, results, limit)
+				if err != nil || len(results) >= limit {
+					return results, err
+				}
+			}
+		}
+		if query.hasStream(LogStreamStderr) {
+			stderrReader, err := p.StderrLogReader()
+			// 标准错误重定向到标准输出时，不重复搜索
+			if err == nil && (stdoutReader == nil || stderrReader.Name() != stdoutReader.Name()) {
+				results, err = searchReader(ctx, stderrReader, match, query, name, LogStreamStderr, results, limit)
+				if err != nil || len(results) >= limit {
+					return results, err
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// 在单个日志流中搜索
+func searchReader(ctx context.Context,
+	reader *proclog.RotatedReader,
+	match func(string) bool,
+	query *LogQuery,
+	name string,
+	stream string,
+	results []*LogMatch,
+	limit int) ([]*LogMatch, error) {
+
+	var ctxErr error
+	before := make([]string, 0, query.Context)
+	pending := make([]*LogMatch, 0) // 还在等待后续上下文的结果
+	count := 0
+	err := reader.ScanLines(func(line *proclog.LogLine) bool {
+		// 第一行以及之后每256行检查一次是否已经取消
+		if count%256 == 0 {
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				return false
+			}
+		}
+		count++
+		if !query.Until.IsZero() && !line.Time.IsZero() && !line.Time.Before(query.Until) {
+			return false
+		}
+		inRange := query.Since.IsZero() || (!line.Time.IsZero() && !line.Time.Before(query.Since))
+
+		// 补充之前匹配结果的后续上下文
+		for len(pending) > 0 && len(pending[0].After) >= query.Context {
+			pending = pending[1:]
+		}
+		for _, m := range pending {
+			m.After = append(m.After, line.Text)
+		}
+
+		if inRange && len(results) < limit && match(line.Text) {
+			m := &LogMatch{
+				Name:   name,
+				Stream: stream,
+				Line:   line.Number,
+				Offset: line.Offset,
+				Time:   line.Time,
+				Text:   line.Text,
+				Before: append([]string{}, before...),
+				After:  make([]string, 0, query.Context),
+			}
+			results = append(results, m)
+			if query.Context > 0 {
+				pending = append(pending, m)
+			}
+		}
+
+		if query.Context > 0 {
+			if len(before) >= query.Context {
+				before = before[1:]
+			}
+			before = append(before, line.Text)
+		}
+		// 结果数已达上限，并且上下文已经补充完整
+		return len(results) < limit || len(pending) > 0 && len(pending[len(pending)-1].After) < query.Context
+	})
+	if err != nil {
+		return results, err
+	}
+	return results, ctxErr
+}
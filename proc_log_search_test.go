@@ -0,0 +1,95 @@
+package processes
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/moqsien/processes/proclog"
+)
+
+// 带有文件日志的进程，用于测试日志搜索
+type logFakeProc struct {
+	fakeProc
+	stdout *proclog.FileLogger
+}
+
+func (that *logFakeProc) StdoutLogReader() (*proclog.RotatedReader, error) {
+	return that.stdout.Reader(), nil
+}
+
+func (that *logFakeProc) StderrLogReader() (*proclog.RotatedReader, error) {
+	return that.stdout.Reader(), nil
+}
+
+// 创建写满多个滚动文件的进程，每行为"line-N"，每个文件保存三行
+func newLogFakeProc(t *testing.T, name string, lines int) *logFakeProc {
+	logger := proclog.NewFileLogger(filepath.Join(t.TempDir(), name+".log"), 16, 10, proclog.NewNullLocker())
+	t.Cleanup(func() { _ = logger.Close() })
+	for i := 1; i <= lines; i++ {
+		_, _ = logger.Write([]byte(fmt.Sprintf("line-%d\n", i)))
+	}
+	return &logFakeProc{fakeProc: fakeProc{name: name, healthy: true}, stdout: logger}
+}
+
+func TestSearchLogsAcrossRotation(t *testing.T) {
+	p := newLogFakeProc(t, "search", 9)
+	manager := NewManager()
+	manager.Set(p.name, p)
+	if backups := proclog.ListBackupFiles(p.stdout.Reader().Name()); len(backups) < 3 {
+		t.Fatalf("日志应该已经滚动为多个文件，得到%v", backups)
+	}
+
+	results, err := manager.SearchLogs(context.Background(), &LogQuery{Pattern: "line-", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 9 {
+		t.Fatalf("应该在所有滚动文件中找到9行，得到%d", len(results))
+	}
+	reader := p.stdout.Reader()
+	for i, m := range results {
+		want := fmt.Sprintf("line-%d", i+1)
+		if m.Text != want || m.Line != int64(i+1) || m.Stream != LogStreamStdout {
+			t.Fatalf("第%d个结果应该为%s，得到%+v", i+1, want, m)
+		}
+		if s, err := reader.ReadLog(m.Offset, int64(len(want))); err != nil || s != want {
+			t.Fatalf("结果的偏移%d应该指向%s，得到%q, %v", m.Offset, want, s, err)
+		}
+	}
+	if m := results[4]; len(m.Before) != 1 || m.Before[0] != "line-4" || len(m.After) != 1 || m.After[0] != "line-6" {
+		t.Fatalf("上下文应该跨越文件，得到%v, %v", m.Before, m.After)
+	}
+}
+
+func TestSearchLogsRegexAndLimit(t *testing.T) {
+	p := newLogFakeProc(t, "limit", 9)
+	manager := NewManager()
+	manager.Set(p.name, p)
+	results, err := manager.SearchLogs(context.Background(), &LogQuery{Pattern: `^LINE-[2-9]$`, Regex: true, IgnoreCase: true, MaxResults: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Text != "line-2" || results[2].Text != "line-4" {
+		t.Fatalf("应该返回前3个匹配的行，得到%d个", len(results))
+	}
+	if _, err = manager.SearchLogs(context.Background(), &LogQuery{Pattern: "(", Regex: true}); err == nil {
+		t.Fatalf("不合法的正则表达式应该返回错误")
+	}
+}
+
+func TestSearchLogsCancelled(t *testing.T) {
+	p := newLogFakeProc(t, "cancel", 5)
+	manager := NewManager()
+	manager.Set(p.name, p)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := manager.SearchLogs(ctx, &LogQuery{Pattern: "line-"})
+	if err != context.Canceled {
+		t.Fatalf("取消搜索时应该返回context.Canceled，得到%v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("搜索开始前已经取消，不应该有结果，得到%d个", len(results))
+	}
+}
@@ -0,0 +1,203 @@
+package processes
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/moqsien/processes/proclog"
+)
+
+// 读取日志文件，文件不存在时返回空
+func readLogFile(path string) string {
+	b, _ := os.ReadFile(path)
+	return string(b)
+}
+
+// 启动一个标准输出写入logfiles的进程
+func startSinkProcess(t *testing.T, name string, logfiles string) *ProcessPlus {
+	p, err := NewManager().NewProcess(name,
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10"}),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStdoutLog(logfiles, ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.StartProc(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return p
+}
+
+// 直接写入进程当前的标准输出日志
+func writeStdout(p *ProcessPlus, s string) {
+	p.Lock.RLock()
+	stdoutLog := p.StdoutLog
+	p.Lock.RUnlock()
+	_, _ = stdoutLog.Write([]byte(s))
+}
+
+func TestRemoveLogSinkRemovesTheNamedSink(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log"), filepath.Join(dir, "c.log")
+	p := startSinkProcess(t, "sink-test", a+","+b)
+	defer p.StopProc(true)
+
+	if err := p.AddLogSink(LogStreamStdout, c); err != nil {
+		t.Fatal(err)
+	}
+	// 移除配置中的第一个日志输出，AddLogSink添加的日志输出不应该受影响
+	if err := p.RemoveLogSink(LogStreamStdout, a); err != nil {
+		t.Fatal(err)
+	}
+	writeStdout(p, "after remove\n")
+
+	if strings.Contains(readLogFile(a), "after remove") {
+		t.Fatalf("移除的日志输出[%s]不应该再写入", a)
+	}
+	for _, f := range []string{b, c} {
+		if !strings.Contains(readLogFile(f), "after remove") {
+			t.Fatalf("日志输出[%s]应该继续写入", f)
+		}
+	}
+}
+
+func TestRemoveLogSinkSingleSink(t *testing.T) {
+	a := filepath.Join(t.TempDir(), "a.log")
+	p := startSinkProcess(t, "single-sink-test", a)
+	defer p.StopProc(true)
+
+	// 只有一个日志输出时，内部的日志对象不是CompositeLogger
+	if err := p.RemoveLogSink(LogStreamStdout, a); err != nil {
+		t.Fatal(err)
+	}
+	writeStdout(p, "after remove\n")
+	if strings.Contains(readLogFile(a), "after remove") {
+		t.Fatalf("移除的日志输出[%s]不应该再写入", a)
+	}
+}
+
+func TestSetLogfileKeepsBackups(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewManager().NewProcess("set-logfile-test",
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10"}),
+		ProcStdoutLog(filepath.Join(dir, "a.log"), "", 3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SetLogfile(LogStreamStdout, filepath.Join(dir, "b.log"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if p.StdoutLogFileBackups != 3 {
+		t.Fatalf("没有指定backups时应该保留原来的备份数量3，得到%d", p.StdoutLogFileBackups)
+	}
+	if err = p.SetLogfile(LogStreamStdout, filepath.Join(dir, "c.log"), "", 5); err != nil {
+		t.Fatal(err)
+	}
+	if p.StdoutLogFileBackups != 5 {
+		t.Fatalf("指定backups时应该使用新的备份数量5，得到%d", p.StdoutLogFileBackups)
+	}
+}
+
+func TestAddLogSinkUnknownScheme(t *testing.T) {
+	p := startSinkProcess(t, "unknown-sink-test", filepath.Join(t.TempDir(), "a.log"))
+	defer p.StopProc(true)
+	if err := p.AddLogSink(LogStreamStdout, "unknown://host"); err == nil {
+		t.Fatalf("未注册的协议应该返回错误")
+	}
+	if strings.Contains(p.StdoutLogfile, "unknown://") {
+		t.Fatalf("添加失败时不应该修改日志配置，得到%s", p.StdoutLogfile)
+	}
+}
+
+// 启动一个写入日志文件的进程，返回进程所在的管理器
+func startReopenProcess(t *testing.T, name string, logfile string) (*Manager, *ProcessPlus) {
+	manager := NewManager()
+	p, err := manager.NewProcess(name,
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10"}),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStdoutLog(logfile, ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.StartProc(true)
+	t.Cleanup(func() { p.StopProc(true) })
+	return manager, p
+}
+
+func TestManagerReopenLogs(t *testing.T) {
+	logfile := filepath.Join(t.TempDir(), "app.log")
+	manager, p := startReopenProcess(t, "reopen-test", logfile)
+	writeStdout(p, "before\n")
+	if err := os.Rename(logfile, logfile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.ReopenLogs("reopen-test"); err != nil {
+		t.Fatal(err)
+	}
+	writeStdout(p, "after\n")
+	if s := readLogFile(logfile); s != "after\n" {
+		t.Fatalf("重新打开后应该写入新的日志文件，得到%q", s)
+	}
+	if s := readLogFile(logfile + ".1"); s != "before\n" {
+		t.Fatalf("移动后的日志文件不应该再写入，得到%q", s)
+	}
+	if err := manager.ReopenLogs("missing"); err == nil {
+		t.Fatalf("进程不存在时应该返回错误")
+	}
+}
+
+func TestManagerReopenLogsOnSignal(t *testing.T) {
+	logfile := filepath.Join(t.TempDir(), "app.log")
+	manager, p := startReopenProcess(t, "reopen-signal-test", logfile)
+	cancel := manager.ReopenLogsOnSignal(syscall.SIGUSR1)
+	defer cancel()
+	writeStdout(p, "before\n")
+	if err := os.Rename(logfile, logfile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	// 收到信号后异步重新打开，新的日志文件被创建时说明已经重新打开
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err := os.Stat(logfile); err != nil; _, err = os.Stat(logfile) {
+		if time.Now().After(deadline) {
+			t.Fatalf("收到信号后应该重新打开日志文件")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeStdout(p, "after\n")
+	if s := readLogFile(logfile); s != "after\n" {
+		t.Fatalf("重新打开后应该写入新的日志文件，得到%q", s)
+	}
+}
+
+func TestEnableConsoleOutputRegistersProcesses(t *testing.T) {
+	manager := NewManager()
+	for _, name := range []string{"web", "background-worker"} {
+		if _, err := manager.NewProcess(name, ProcPath("/bin/true")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	sink := proclog.NewConsoleSink(&buf, false)
+	manager.EnableConsoleOutput(sink)
+	// 已加入管理器的进程名称预先注册，先输出的短名称也按最长的名称对齐
+	_, _ = sink.NewLogger("web", "stdout").Write([]byte("hello\n"))
+	if want := "web               | hello\n"; buf.String() != want {
+		t.Fatalf("期望%q，得到%q", want, buf.String())
+	}
+}
@@ -3,11 +3,14 @@ package processes
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/gogf/gf/container/gmap"
 	"github.com/gogf/gf/errors/gerror"
 	"github.com/moqsien/processes/logger"
+	"github.com/moqsien/processes/proclog"
 )
 
 type IProc interface {
@@ -19,14 +22,30 @@ type IProc interface {
 
 type Manager struct {
 	*gmap.StrAnyMap
+	lock     sync.RWMutex         // 保护进程列表以外的字段
+	events   *eventBus            // 事件的订阅者
+	quota    *logQuota            // 日志的总容量配额
+	console  *proclog.ConsoleSink // 聚合的控制台输出，nil表示不输出
+	programs map[string]*Program  // 多实例的程序，key为程序名称
+	groups   map[string]*Group    // 进程组，key为组名称
+
+	listeners map[string]*managedListener // 管理器持有的监听socket，key为"network://address"
+	onDemand  map[string]*onDemand        // 按需启动的进程，key为进程名称
 }
 
 func NewManager() *Manager {
 	return &Manager{
 		StrAnyMap: gmap.NewStrAnyMap(),
+		events:    newEventBus(),
+		quota:     &logQuota{},
+		programs:  make(map[string]*Program),
+		groups:    make(map[string]*Group),
+		listeners: make(map[string]*managedListener),
+		onDemand:  make(map[string]*onDemand),
 	}
 }
 
+// NewProcess 创建进程并加入管理器，设置了NumProcs大于1时创建多个进程实例，作为一个程序管理，返回第一个进程实例
 func (that *Manager) NewProcess(name string, options ...Option) (p *ProcessPlus, err error) {
 	p = NewProcess(os.Args[0], name)
 	if _, found := that.Search(p.Name); found {
@@ -39,7 +58,25 @@ func (that *Manager) NewProcess(name string, options ...Option) (p *ProcessPlus,
 			option(p)
 		}
 	}
+	if p.NumProcs > 1 {
+		first, err := that.newProgram(p)
+		if err == nil {
+			that.joinGroup(p.Name, p.Group)
+		}
+		return first, err
+	}
+	// 保留展开之前的配置，之后通过Scale伸缩为程序时，新的进程实例按原来的模板展开
+	tpl, _ := p.Clone()
+	p.template = tpl.(*ProcessPlus)
+	p.expandInstance(p.Name, p.NumProcsStart)
+	if len(p.ProcessName) > 0 { // 设置了名称模板时，使用展开后的名称
+		if _, found := that.Search(p.Name); found {
+			return nil, gerror.Newf("进程[%s]已存在", p.Name)
+		}
+		name = p.Name
+	}
 	that.Add(name, p) // 添加进程
+	that.joinGroup(name, p.Group)
 	return p, nil
 }
 
@@ -58,24 +95,25 @@ func (that *Manager) SearchProc(name string) (value IProc, found bool) {
 	return
 }
 
-// Remove 从列表移除进程
+// Remove 从列表移除进程，没有其他进程使用的监听socket会被关闭
 func (that *Manager) Remove(name string) (value IProc) {
 	that.StrAnyMap.Remove(name)
+	that.disarmOnDemand(name)
+	that.releaseListeners(name)
+	that.lock.RLock()
+	for _, group := range that.groups {
+		group.remove(name)
+	}
+	that.lock.RUnlock()
 	return
 }
 
-// StopAllProcs 停止所有进程
+// StopAllProcs 按进程组和进程优先级的相反顺序停止所有进程，并停止等待按需启动的连接
 func (that *Manager) StopAllProcs() {
-	var wg sync.WaitGroup
-	that.Iterator(func(_ string, value interface{}) bool {
-		wg.Add(1)
-		go func(w *sync.WaitGroup) {
-			defer w.Done()
-			value.(IProc).StopProc(true)
-		}(&wg)
-		return true
+	_ = that.StopOnDemand()
+	that.runBands(that.priorityBands(that.GetAllProcs(), true), true, func(p IProc) {
+		p.StopProc(true)
 	})
-	wg.Wait()
 }
 
 // GetAllProcs 获取所有进程的列表
@@ -99,7 +137,11 @@ func (that *Manager) GetAllProcsInfo() ([]*Info, error) {
 	return AllProcessInfo, nil
 }
 
-// GracefulReload 平滑重启
+/*
+GracefulReload 平滑重启：先启动克隆的新进程，等待它进入Running状态并且就绪探针检查通过后，
+用新进程替换管理器中的原进程，经过ReloadOverlapSecs的重叠时间后再停止原进程；
+新进程没有就绪时停止新进程，保留原进程并返回错误。wait为false时异步执行，结果通过RELOAD_*事件通知
+*/
 func (that *Manager) GracefulReload(name string, wait bool) (bool, error) {
 	logger.Infof("平滑重启进程[%s]", name)
 	p, ok := that.Search(name)
@@ -112,8 +154,122 @@ func (that *Manager) GracefulReload(name string, wait bool) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	procClone.StartProc(wait)
-	proc.StopProc(wait)
+	if !wait {
+		go func() {
+			_ = that.reload(name, proc, procClone)
+		}()
+		return true, nil
+	}
+	if err = that.reload(name, proc, procClone); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 执行平滑重启，新进程就绪后才停止原进程，否则回滚
+func (that *Manager) reload(name string, proc IProc, procClone IProc) error {
+	overlap := 0
+	if p, ok := proc.(*ProcessPlus); ok {
+		overlap = p.ReloadOverlapSecs
+	}
+
+	procClone.StartProc(true)
+	if err := waitReady(procClone, 0); err != nil {
+		// 回滚：停止新进程，原进程继续运行
+		procClone.StopProc(true)
+		err = gerror.Wrapf(err, "平滑重启进程[%s]失败，新进程没有就绪，已停止新进程并保留原进程", name)
+		logger.Error(err)
+		that.emit(Event{Type: EventReloadFailed, Name: name, Message: err.Error()})
+		return err
+	}
+
 	that.Add(name, procClone)
-	return ok, nil
+	if overlap > 0 {
+		logger.Infof("进程[%s]的新进程已经就绪，%d秒后停止原进程", name, overlap)
+		time.Sleep(time.Duration(overlap) * time.Second)
+	}
+	proc.StopProc(true)
+	logger.Infof("平滑重启进程[%s]成功", name)
+	that.emit(Event{Type: EventReloadSucceeded, Name: name, Message: fmt.Sprintf("平滑重启进程[%s]成功", name)})
+	return nil
+}
+
+/*
+EnableConsoleOutput 开启聚合的控制台输出(类似foreman)：所有进程的标准输出和标准错误在保留原有日志的同时，
+按整行输出到管理进程的标准输出，每行前添加补齐长度并着色的进程名称，标准错误的行使用"!"标记，
+sink为空时使用proclog.DefaultConsole()，对之后启动(或重启)的进程生效；
+已加入管理器的进程名称会预先注册，使进程名称的列宽一开始就固定
+*/
+func (that *Manager) EnableConsoleOutput(sink ...*proclog.ConsoleSink) {
+	console := proclog.DefaultConsole()
+	if len(sink) > 0 && sink[0] != nil {
+		console = sink[0]
+	}
+	console.Register(that.Keys()...)
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	that.console = console
+}
+
+// DisableConsoleOutput 关闭聚合的控制台输出，对之后启动(或重启)的进程生效
+func (that *Manager) DisableConsoleOutput() {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	that.console = nil
+}
+
+// ConsoleSink 获取聚合的控制台输出，没有开启时返回nil
+func (that *Manager) ConsoleSink() *proclog.ConsoleSink {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	return that.console
+}
+
+// ReopenLogs 重新打开进程的日志文件，names的格式见Resolve，为空时重新打开所有进程的日志文件
+func (that *Manager) ReopenLogs(names ...string) error {
+	type logReopener interface {
+		ReopenLogs() error
+	}
+	names, err := that.resolveLogTargets(names, "")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		proc, found := that.SearchProc(name)
+		if !found {
+			return gerror.Newf("没有找到进程[%s]", name)
+		}
+		if reopener, ok := proc.(logReopener); ok {
+			if e := reopener.ReopenLogs(); e != nil {
+				logger.Errorf("重新打开进程[%s]的日志文件失败：%v", name, e)
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// ReopenLogsOnSignal 管理进程收到sig信号(如SIGUSR1)时重新打开所有进程的日志文件，返回取消监听的函数
+func (that *Manager) ReopenLogsOnSignal(sig os.Signal) (cancel func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sig)
+	go func() {
+		for {
+			select {
+			case <-c:
+				logger.Infof("收到信号[%v]，重新打开日志文件", sig)
+				_ = that.ReopenLogs()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
 }
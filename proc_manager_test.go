@@ -0,0 +1,75 @@
+package processes
+
+import (
+	"testing"
+)
+
+// 用于测试平滑重启的进程，记录启动和停止，克隆出的新进程是否健康由cloneHealthy决定
+type reloadFakeProc struct {
+	fakeProc
+	cloneHealthy bool
+	started      bool
+	stopped      bool
+	clone        *reloadFakeProc
+}
+
+func (that *reloadFakeProc) StartProc(wait bool) { that.started = true }
+
+func (that *reloadFakeProc) StopProc(wait bool) { that.stopped = true }
+
+func (that *reloadFakeProc) Clone() (IProc, error) {
+	that.clone = &reloadFakeProc{fakeProc: fakeProc{name: that.name, healthy: that.cloneHealthy}}
+	return that.clone, nil
+}
+
+// 订阅管理器的事件，返回收到的事件类型
+func recordEvents(manager *Manager) *[]EventType {
+	events := make([]EventType, 0)
+	manager.Subscribe(func(e Event) {
+		events = append(events, e.Type)
+	})
+	return &events
+}
+
+func TestGracefulReloadRollback(t *testing.T) {
+	old := &reloadFakeProc{fakeProc: fakeProc{name: "api", healthy: true}}
+	manager := NewManager()
+	manager.Set("api", old)
+	events := recordEvents(manager)
+
+	if ok, err := manager.GracefulReload("api", true); ok || err == nil {
+		t.Fatalf("新进程没有就绪时应该返回错误，得到%v, %v", ok, err)
+	}
+	if !old.clone.started || !old.clone.stopped {
+		t.Fatalf("没有就绪的新进程应该被启动后停止")
+	}
+	if old.stopped {
+		t.Fatalf("回滚时不应该停止原进程")
+	}
+	if value, _ := manager.Search("api"); value != old {
+		t.Fatalf("回滚后管理器中应该仍然是原进程")
+	}
+	if len(*events) != 1 || (*events)[0] != EventReloadFailed {
+		t.Fatalf("应该只产生RELOAD_FAILED事件，得到%v", *events)
+	}
+}
+
+func TestGracefulReloadReplaces(t *testing.T) {
+	old := &reloadFakeProc{fakeProc: fakeProc{name: "api", healthy: true}, cloneHealthy: true}
+	manager := NewManager()
+	manager.Set("api", old)
+	events := recordEvents(manager)
+
+	if ok, err := manager.GracefulReload("api", true); !ok || err != nil {
+		t.Fatalf("平滑重启应该成功，得到%v, %v", ok, err)
+	}
+	if value, _ := manager.Search("api"); value != old.clone {
+		t.Fatalf("管理器中应该替换为新进程")
+	}
+	if !old.stopped || old.clone.stopped {
+		t.Fatalf("应该停止原进程并保留新进程")
+	}
+	if len(*events) != 1 || (*events)[0] != EventReloadSucceeded {
+		t.Fatalf("应该只产生RELOAD_SUCCEEDED事件，得到%v", *events)
+	}
+}
@@ -0,0 +1,270 @@
+package processes
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/moqsien/processes/logger"
+	"github.com/moqsien/processes/signals"
+)
+
+const EventWatchdogTimeout EventType = "WATCHDOG_TIMEOUT" // 进程没有按时发送WATCHDOG=1，已经结束进程等待重启
+
+// sd_notify协议的NOTIFY_SOCKET，每次启动进程时创建，进程退出后关闭
+type notifySocket struct {
+	dir          string
+	path         string
+	conn         *net.UnixConn
+	stop         chan struct{}
+	lastPing     int64 // 最近一次WATCHDOG=1的时间(UnixNano)，0表示收到了WATCHDOG=trigger
+	watchdogUsec int64 // 看门狗超时的微秒数，进程可以通过WATCHDOG_USEC=修改
+}
+
+// 获取进程的会话id
+func getsid(pid int) (int, error) {
+	sid, _, errno := syscall.RawSyscall(syscall.SYS_GETSID, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(sid), nil
+}
+
+/*
+创建进程的NOTIFY_SOCKET(unixgram)，并设置NOTIFY_SOCKET和WATCHDOG_USEC环境变量；
+socket放在只有管理进程可以列出的临时目录中，以ProcUser设置的用户运行的进程也可以写入
+*/
+func (that *ProcessPlus) openNotify() error {
+	that.closeNotify()
+	if !that.Notify {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "processes-notify-")
+	if err != nil {
+		return err
+	}
+	_ = os.Chmod(dir, 0711)
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return err
+	}
+	_ = os.Chmod(path, 0666)
+	// 接收发送方的凭据(SCM_CREDENTIALS)，用于校验MAINPID=的发送方
+	if err = passCred(conn); err != nil {
+		_ = conn.Close()
+		_ = os.RemoveAll(dir)
+		return err
+	}
+
+	notify := &notifySocket{
+		dir:          dir,
+		path:         path,
+		conn:         conn,
+		stop:         make(chan struct{}),
+		lastPing:     time.Now().UnixNano(),
+		watchdogUsec: int64(that.WatchdogSecs) * 1000000,
+	}
+	that.notify = notify
+	that.Env = append(that.Env, "NOTIFY_SOCKET="+path)
+	if notify.watchdogUsec > 0 {
+		that.Env = append(that.Env, "WATCHDOG_USEC="+strconv.FormatInt(notify.watchdogUsec, 10))
+	}
+	go that.readNotify(notify)
+	if notify.watchdogUsec > 0 {
+		go that.watchdog(notify)
+	}
+	return nil
+}
+
+// 关闭NOTIFY_SOCKET，停止看门狗
+func (that *ProcessPlus) closeNotify() {
+	notify := that.notify
+	if notify == nil {
+		return
+	}
+	that.notify = nil
+	close(notify.stop)
+	_ = notify.conn.Close()
+	_ = os.RemoveAll(notify.dir)
+}
+
+// 在socket上开启SO_PASSCRED
+func passCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// 从控制消息中解析发送方的pid，没有凭据时返回0
+func senderPid(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for i := range msgs {
+		if cred, err := syscall.ParseUnixCredentials(&msgs[i]); err == nil {
+			return int(cred.Pid)
+		}
+	}
+	return 0
+}
+
+// 读取进程发送的通知，每个数据报包含多行KEY=VALUE
+func (that *ProcessPlus) readNotify(notify *notifySocket) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+	for {
+		n, oobn, _, _, err := notify.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+		sender := senderPid(oob[:oobn])
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if pos := strings.Index(line, "="); pos > 0 {
+				that.handleNotify(notify, sender, line[:pos], line[pos+1:])
+			}
+		}
+	}
+}
+
+/*
+检查sender通过MAINPID=通知的新主进程pid是否可信：只接受当前主进程发送的通知，
+新的主进程不能是init或者管理进程本身，并且要和启动的进程在同一个进程组，
+或者和发送方在同一个(不是管理进程的)会话中，避免进程把管理的信号和退出等待转移到无关的进程上
+*/
+func (that *ProcessPlus) trustMainPid(sender int, pid int) bool {
+	if pid <= 1 || pid == os.Getpid() {
+		return false
+	}
+	that.Lock.RLock()
+	if that.Process == nil {
+		that.Lock.RUnlock()
+		return false
+	}
+	// 进程以Setpgid启动，进程组id就是启动的进程的pid
+	childPid := that.Process.Pid
+	that.Lock.RUnlock()
+	current := int(atomic.LoadInt32(&that.mainPid))
+	if current <= 0 {
+		current = childPid
+	}
+	if sender <= 0 || sender != current {
+		return false
+	}
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == childPid {
+		return true
+	}
+	sid, err := getsid(pid)
+	if err != nil {
+		return false
+	}
+	senderSid, err := getsid(sender)
+	if err != nil || sid != senderSid {
+		return false
+	}
+	ownSid, err := getsid(0)
+	return err == nil && sid != ownSid
+}
+
+// 处理一条通知，sender为发送方的pid
+func (that *ProcessPlus) handleNotify(notify *notifySocket, sender int, key string, value string) {
+	switch key {
+	case "READY":
+		if value == "1" {
+			atomic.StoreInt64(&notify.lastPing, time.Now().UnixNano())
+			that.markReady()
+		}
+	case "STATUS":
+		that.Lock.Lock()
+		that.notifyStatus = value
+		that.Lock.Unlock()
+	case "MAINPID":
+		pid, err := strconv.Atoi(value)
+		if err != nil || !that.trustMainPid(sender, pid) {
+			logger.Warningf("忽略进程[%s]来自[%d]的通知[MAINPID=%s]", that.Name, sender, value)
+			return
+		}
+		logger.Infof("进程[%s]的主进程变为[%d]", that.Name, pid)
+		atomic.StoreInt32(&that.mainPid, int32(pid))
+	case "WATCHDOG":
+		if value == "1" {
+			atomic.StoreInt64(&notify.lastPing, time.Now().UnixNano())
+		} else if value == "trigger" {
+			atomic.StoreInt64(&notify.lastPing, 0)
+		}
+	case "WATCHDOG_USEC":
+		if usec, err := strconv.ParseInt(value, 10, 64); err == nil && usec > 0 {
+			atomic.StoreInt64(&notify.watchdogUsec, usec)
+		}
+	default:
+		logger.Debugf("进程[%s]的通知[%s=%s]没有处理", that.Name, key, value)
+	}
+}
+
+// 看门狗：进程Running之后，超过WATCHDOG_USEC没有收到WATCHDOG=1时发送SIGABRT结束进程，由自动重启规则重启进程
+func (that *ProcessPlus) watchdog(notify *notifySocket) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-notify.stop:
+			return
+		case <-ticker.C:
+		}
+		that.Lock.RLock()
+		running := that.State == Running
+		that.Lock.RUnlock()
+		if !running {
+			continue
+		}
+		timeout := time.Duration(atomic.LoadInt64(&notify.watchdogUsec)) * time.Microsecond
+		lastPing := atomic.LoadInt64(&notify.lastPing)
+		if lastPing != 0 && time.Since(time.Unix(0, lastPing)) <= timeout {
+			continue
+		}
+
+		message := fmt.Sprintf("进程[%s]的看门狗超时(%v)，结束进程", that.Name, timeout)
+		logger.Error(message)
+		if that.ProcManager != nil {
+			that.ProcManager.emit(Event{Type: EventWatchdogTimeout, Name: that.Name, Message: message})
+		}
+		_ = that.Signal(syscall.SIGABRT, that.KillAsGroup)
+		killTime := time.Now().Add(time.Duration(that.KillWaitSecs) * time.Second)
+		for time.Now().Before(killTime) && that.IsRunning() {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if that.IsRunning() {
+			_ = that.Signal(syscall.SIGKILL, that.KillAsGroup)
+		}
+		return
+	}
+}
+
+// fork类型的守护进程：启动的进程退出后，如果通过MAINPID=通知了新的主进程，等待新的主进程退出
+func (that *ProcessPlus) waitMainPid() {
+	// 主进程退出后不再把信号发送到这个pid，它可能已经被其他进程重用
+	defer atomic.StoreInt32(&that.mainPid, 0)
+	for {
+		pid := atomic.LoadInt32(&that.mainPid)
+		if pid <= 0 || (that.Process != nil && int(pid) == that.Process.Pid) || !signals.CheckPidExist(int(pid)) {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,59 @@
+package processes
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestNotifySenderCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err = passCred(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	if _, err = client.Write([]byte("MAINPID=1234\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid := senderPid(oob[:oobn]); pid != os.Getpid() {
+		t.Fatalf("发送方的pid应该为%d，得到%d", os.Getpid(), pid)
+	}
+	if pid := senderPid(nil); pid != 0 {
+		t.Fatalf("没有凭据时发送方的pid应该为0，得到%d", pid)
+	}
+}
+
+func TestTrustMainPid(t *testing.T) {
+	p := startSinkProcess(t, "notify-test", filepath.Join(t.TempDir(), "notify.log"))
+	defer p.StopProc(true)
+	child := p.Pid()
+
+	if p.trustMainPid(child, 1) || p.trustMainPid(child, os.Getpid()) {
+		t.Fatalf("不应该接受init或者管理进程作为主进程")
+	}
+	if p.trustMainPid(0, child) || p.trustMainPid(os.Getpid(), child) {
+		t.Fatalf("不应该接受主进程以外的进程发送的MAINPID")
+	}
+	if !p.trustMainPid(child, child) {
+		t.Fatalf("应该接受同一个进程组中的进程作为主进程")
+	}
+}
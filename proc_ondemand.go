@@ -0,0 +1,360 @@
+package processes
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+const (
+	EventOnDemandStarted EventType = "ONDEMAND_STARTED" // 按需启动的进程收到第一个连接，已经启动
+	EventOnDemandIdle    EventType = "ONDEMAND_IDLE"    // 按需启动的进程空闲超时，已经停止
+)
+
+// 按需启动的进程启动失败后，再次等待连接前的暂停时间
+var onDemandRetryPause = 3 * time.Second
+
+/*
+按需启动的监控：管理器持有进程的监听socket并等待连接(不accept)，收到连接时启动进程，由进程自己accept；
+进程退出后重新等待连接，设置了IdleStopSecs时，进程在该时间内没有任何连接就停止进程
+*/
+type onDemand struct {
+	name    string
+	manager *Manager
+	files   []*os.File
+	specs   []*ListenerSpec
+	stop    chan struct{}
+	wakeR   *os.File // 停止时通过管道唤醒epoll
+	wakeW   *os.File
+}
+
+// StartOnDemand 让目标进程按需启动，targets的格式见Resolve，进程需要设置ProcOnDemand和ProcListener
+func (that *Manager) StartOnDemand(targets ...string) error {
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return err
+	}
+	for _, proc := range procs {
+		p, ok := proc.(*ProcessPlus)
+		if !ok || !p.OnDemand || len(p.Listeners) == 0 {
+			return gerror.Newf("进程[%s]没有设置按需启动或者监听socket", proc.GetProcessInfo().Name)
+		}
+		if err = that.armOnDemand(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopOnDemand 停止等待连接，不会停止已经启动的进程，targets为空时停止所有进程的按需启动
+func (that *Manager) StopOnDemand(targets ...string) error {
+	names := make([]string, 0)
+	if len(targets) == 0 {
+		that.lock.RLock()
+		for name := range that.onDemand {
+			names = append(names, name)
+		}
+		that.lock.RUnlock()
+	} else {
+		procs, err := that.resolveAll(targets)
+		if err != nil {
+			return err
+		}
+		for _, proc := range procs {
+			names = append(names, proc.GetProcessInfo().Name)
+		}
+	}
+	for _, name := range names {
+		that.disarmOnDemand(name)
+	}
+	return nil
+}
+
+// 开始等待进程的连接，已经在等待时忽略
+func (that *Manager) armOnDemand(p *ProcessPlus) error {
+	that.lock.RLock()
+	_, found := that.onDemand[p.Name]
+	that.lock.RUnlock()
+	if found {
+		return nil
+	}
+
+	files, err := that.acquireListeners(p.Name, p.Listeners)
+	if err != nil {
+		return err
+	}
+	wakeR, wakeW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	watcher := &onDemand{
+		name:    p.Name,
+		manager: that,
+		files:   files,
+		specs:   p.Listeners,
+		stop:    make(chan struct{}),
+		wakeR:   wakeR,
+		wakeW:   wakeW,
+	}
+	that.lock.Lock()
+	if _, found = that.onDemand[p.Name]; found {
+		that.lock.Unlock()
+		_ = wakeR.Close()
+		_ = wakeW.Close()
+		return nil
+	}
+	that.onDemand[p.Name] = watcher
+	that.lock.Unlock()
+
+	logger.Infof("进程[%s]按需启动，等待连接", p.Name)
+	go watcher.run()
+	return nil
+}
+
+// 停止等待进程的连接
+func (that *Manager) disarmOnDemand(name string) {
+	that.lock.Lock()
+	watcher, found := that.onDemand[name]
+	delete(that.onDemand, name)
+	that.lock.Unlock()
+	if found {
+		close(watcher.stop)
+		_ = watcher.wakeW.Close()
+	}
+}
+
+// 等待连接、启动进程、检查空闲，直到停止按需启动
+func (that *onDemand) run() {
+	defer func() { _ = that.wakeR.Close() }()
+	for {
+		if !that.waitConn() {
+			return
+		}
+		proc, found := that.lookup()
+		if !found {
+			return
+		}
+		logger.Infof("进程[%s]收到连接，按需启动", that.name)
+		proc.StartProc(true)
+		that.manager.emit(Event{Type: EventOnDemandStarted, Name: that.name, Message: fmt.Sprintf("进程[%s]收到连接，按需启动", that.name)})
+		proc.Lock.RLock()
+		fatal := proc.State == Fatal
+		proc.Lock.RUnlock()
+		if fatal {
+			// 连接还在队列中，暂停一会再等待，避免不停地重启
+			select {
+			case <-time.After(onDemandRetryPause):
+			case <-that.stop:
+				return
+			}
+			continue
+		}
+		if !that.watchIdle() {
+			return
+		}
+	}
+}
+
+// 按名称查找进程，进程可能在按需启动期间被替换(如重新加载配置)
+func (that *onDemand) lookup() (*ProcessPlus, bool) {
+	value, found := that.manager.SearchProc(that.name)
+	if !found {
+		return nil, false
+	}
+	proc, ok := value.(*ProcessPlus)
+	return proc, ok
+}
+
+// 通过epoll等待任一监听socket上有新的连接，返回false表示已经停止
+func (that *onDemand) waitConn() bool {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		logger.Errorf("进程[%s]按需启动失败：%v", that.name, err)
+		return false
+	}
+	defer func() { _ = syscall.Close(epfd) }()
+
+	fds := []int{int(that.wakeR.Fd())}
+	for _, file := range that.files {
+		fds = append(fds, int(file.Fd()))
+	}
+	for _, fd := range fds {
+		event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		if err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &event); err != nil {
+			logger.Errorf("进程[%s]按需启动失败：%v", that.name, err)
+			return false
+		}
+	}
+
+	events := make([]syscall.EpollEvent, len(fds))
+	for {
+		n, err := syscall.EpollWait(epfd, events, -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			logger.Errorf("进程[%s]等待连接失败：%v", that.name, err)
+			return false
+		}
+		select {
+		case <-that.stop:
+			return false
+		default:
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+/*
+进程运行期间每秒按名称查找并检查一次进程，进程退出时返回true，重新等待连接；
+设置了IdleStopSecs时，监听地址上持续没有连接超过该时间就停止进程；停止按需启动或者进程已经被移除时返回false
+*/
+func (that *onDemand) watchIdle() bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastActive := time.Now()
+	for {
+		select {
+		case <-that.stop:
+			return false
+		case <-ticker.C:
+		}
+		proc, found := that.lookup()
+		if !found {
+			return false
+		}
+		proc.Lock.RLock()
+		exited := proc.State&Exist == 0 && !proc.Starting
+		proc.Lock.RUnlock()
+		if exited {
+			logger.Infof("按需启动的进程[%s]已经退出，重新等待连接", that.name)
+			return true
+		}
+		if proc.IdleStopSecs <= 0 {
+			continue
+		}
+		if that.activeConns() > 0 {
+			lastActive = time.Now()
+			continue
+		}
+		if time.Since(lastActive) >= time.Duration(proc.IdleStopSecs)*time.Second {
+			logger.Infof("按需启动的进程[%s]空闲超过%d秒，停止进程", that.name, proc.IdleStopSecs)
+			proc.StopProc(true)
+			that.manager.emit(Event{Type: EventOnDemandIdle, Name: that.name, Message: fmt.Sprintf("进程[%s]空闲超过%d秒，已经停止", that.name, proc.IdleStopSecs)})
+			return true
+		}
+	}
+}
+
+// 统计所有监听地址上已经建立的连接数，包括还没有accept的连接
+func (that *onDemand) activeConns() int {
+	count := 0
+	for i, spec := range that.specs {
+		if spec.Network == "unix" {
+			count += countUnixConns("/proc/net/unix", spec.Address)
+			continue
+		}
+		sa, err := syscall.Getsockname(int(that.files[i].Fd()))
+		if err != nil {
+			continue
+		}
+		var ip net.IP
+		port := 0
+		switch addr := sa.(type) {
+		case *syscall.SockaddrInet4:
+			ip, port = net.IP(addr.Addr[:]), addr.Port
+		case *syscall.SockaddrInet6:
+			ip, port = net.IP(addr.Addr[:]), addr.Port
+		}
+		count += countTCPConns("/proc/net/tcp", ip, port) + countTCPConns("/proc/net/tcp6", ip, port)
+	}
+	return count
+}
+
+// 本机是否为小端字节序，/proc/net/tcp中的地址按本机字节序的32位整数输出
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// 解析/proc/net/tcp中的地址，如0100007F:1F90为127.0.0.1:8080
+func parseProcNetAddr(s string) (net.IP, int, bool) {
+	pos := strings.Index(s, ":")
+	if pos < 0 {
+		return nil, 0, false
+	}
+	b, err := hex.DecodeString(s[:pos])
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, false
+	}
+	port, err := strconv.ParseUint(s[pos+1:], 16, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	if nativeLittleEndian {
+		for i := 0; i < len(b); i += 4 {
+			b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+		}
+	}
+	return net.IP(b), int(port), true
+}
+
+/*
+从/proc/net/tcp统计本地地址为ip:port的ESTABLISHED连接数；
+ip为空或者为通配地址(0.0.0.0、::)时，监听socket接受所有本机地址上的连接，只比较端口
+*/
+func countTCPConns(path string, ip net.IP, port int) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer func() { _ = file.Close() }()
+	anyAddr := len(ip) == 0 || ip.IsUnspecified()
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sl local_address rem_address st ...，st为01表示ESTABLISHED
+		if len(fields) <= 3 || fields[3] != "01" {
+			continue
+		}
+		localIP, localPort, ok := parseProcNetAddr(fields[1])
+		if ok && localPort == port && (anyAddr || localIP.Equal(ip)) {
+			count++
+		}
+	}
+	return count
+}
+
+// 从/proc/net/unix格式的文件统计绑定在path上的已连接socket数
+func countUnixConns(procPath string, path string) int {
+	file, err := os.Open(procPath)
+	if err != nil {
+		return 0
+	}
+	defer func() { _ = file.Close() }()
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Num RefCount Protocol Flags Type St Inode Path，St为03表示已连接
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 7 && fields[7] == path {
+			if st, err := strconv.ParseInt(fields[5], 16, 32); err == nil && st == 3 {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,193 @@
+package processes
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 写入/proc/net格式的测试文件
+func writeProcNet(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "net")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCountTCPConns(t *testing.T) {
+	if !nativeLittleEndian {
+		t.Skip("测试数据按小端字节序编写")
+	}
+	tcp := writeProcNet(t, `  sl  local_address rem_address   st tx_queue rx_queue
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000
+   1: 0100007F:1F90 0100007F:C350 01 00000000:00000000
+   2: 0200007F:1F90 0100007F:C351 01 00000000:00000000
+   3: 0100007F:1F91 0100007F:C352 01 00000000:00000000
+   4: 0100007F:1F90 0100007F:C353 08 00000000:00000000
+`)
+	tcp6 := writeProcNet(t, `  sl  local_address                         remote_address                        st
+   0: 0000000000000000FFFF00000100007F:1F90 0000000000000000FFFF00000100007F:C354 01
+   1: 00000000000000000000000001000000:1F90 00000000000000000000000001000000:C355 01
+`)
+	cases := []struct {
+		path string
+		ip   net.IP
+		port int
+		want int
+	}{
+		{tcp, net.ParseIP("127.0.0.1"), 8080, 1},
+		{tcp, net.ParseIP("127.0.0.2"), 8080, 1},
+		{tcp, net.ParseIP("127.0.0.3"), 8080, 0},
+		{tcp, net.IPv4zero, 8080, 2},
+		{tcp, nil, 8081, 1},
+		{tcp6, net.ParseIP("127.0.0.1"), 8080, 1},
+		{tcp6, net.IPv6loopback, 8080, 1},
+		{tcp6, net.IPv6unspecified, 8080, 2},
+		{filepath.Join(t.TempDir(), "missing"), nil, 8080, 0},
+	}
+	for _, c := range cases {
+		if got := countTCPConns(c.path, c.ip, c.port); got != c.want {
+			t.Fatalf("%v:%d的连接数应该为%d，得到%d", c.ip, c.port, c.want, got)
+		}
+	}
+}
+
+func TestCountUnixConns(t *testing.T) {
+	path := writeProcNet(t, `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 12345 /run/a.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 12346 /run/a.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 12347 /run/b.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 12348
+`)
+	if got := countUnixConns(path, "/run/a.sock"); got != 1 {
+		t.Fatalf("/run/a.sock上应该有1个已连接的socket，得到%d", got)
+	}
+	if got := countUnixConns(path, "/run/c.sock"); got != 0 {
+		t.Fatalf("/run/c.sock上不应该有连接，得到%d", got)
+	}
+}
+
+// 创建按需启动的进程并开始等待连接，返回监听地址和事件通道
+func startOnDemand(t *testing.T, name string, opts ...Option) (*Manager, string, chan Event) {
+	manager := NewManager()
+	opts = append([]Option{ProcListener("web", "tcp://127.0.0.1:0"), ProcAutoReStart(AutoReStartFalse)}, opts...)
+	p, err := manager.NewProcess(name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan Event, 16)
+	cancel := manager.Subscribe(func(e Event) {
+		if e.Type == EventOnDemandStarted || e.Type == EventOnDemandIdle {
+			events <- e
+		}
+	})
+	if err = manager.StartOnDemand(name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = manager.StopOnDemand()
+		p.StopProc(true)
+		manager.releaseListeners(name)
+	})
+	manager.lock.RLock()
+	file := manager.listeners["tcp://127.0.0.1:0"].file
+	manager.lock.RUnlock()
+	sa, err := syscall.Getsockname(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+	return manager, addr.String(), events
+}
+
+func waitEvent(t *testing.T, events chan Event, eventType EventType) {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e.Type != eventType {
+			t.Fatalf("应该收到%s事件，得到%s", eventType, e.Type)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("没有收到%s事件", eventType)
+	}
+}
+
+// 代替子进程accept监听socket上排队的连接
+func acceptQueued(t *testing.T, manager *Manager) {
+	manager.lock.RLock()
+	file := manager.listeners["tcp://127.0.0.1:0"].file
+	manager.lock.RUnlock()
+	l, err := net.FileListener(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestOnDemandStartsAndStopsWhenIdle(t *testing.T) {
+	manager, addr, events := startOnDemand(t, "ondemand-idle",
+		ProcPath("/bin/sleep"), ProcArgs([]string{"30"}), ProcOnDemand(1))
+	value, _ := manager.SearchProc("ondemand-idle")
+	p := value.(*ProcessPlus)
+	if p.IsRunning() {
+		t.Fatalf("收到连接之前不应该启动进程")
+	}
+
+	// 收到连接时通过epoll唤醒并启动进程
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, EventOnDemandStarted)
+	if !p.IsRunning() {
+		t.Fatalf("收到连接后进程应该处于运行状态")
+	}
+
+	// 连接结束后空闲超过1秒时停止进程
+	acceptQueued(t, manager)
+	_ = conn.Close()
+	waitEvent(t, events, EventOnDemandIdle)
+	if p.IsRunning() {
+		t.Fatalf("空闲超时后进程应该已经停止")
+	}
+
+	// 停止后重新等待连接
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	waitEvent(t, events, EventOnDemandStarted)
+	acceptQueued(t, manager)
+}
+
+func TestOnDemandRetriesAfterFatal(t *testing.T) {
+	pause := onDemandRetryPause
+	onDemandRetryPause = 100 * time.Millisecond
+	defer func() { onDemandRetryPause = pause }()
+
+	manager, addr, events := startOnDemand(t, "ondemand-fatal",
+		ProcPath(filepath.Join(t.TempDir(), "missing")), ProcStartRetries(1), ProcOnDemand())
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	// 启动失败后暂停一会，连接还在队列中，再次尝试启动
+	waitEvent(t, events, EventOnDemandStarted)
+	waitEvent(t, events, EventOnDemandStarted)
+	value, _ := manager.SearchProc("ondemand-fatal")
+	if info := value.GetProcessInfo(); info.State == int(Running) {
+		t.Fatalf("进程不应该启动成功，得到%s", info.StateName)
+	}
+}
@@ -0,0 +1,234 @@
+package processes
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/proclog"
+)
+
+// NumProcs大于1或者伸缩单进程时默认的进程实例名称模板
+const defaultProcessName = "%(program_name)s_%(process_num)02d"
+
+// 名称模板中的变量，如%(program_name)s、%(process_num)02d
+var templatePattern = regexp.MustCompile(`%\((\w+)\)([-+# 0]*\d*(?:\.\d+)?[sdvxXo])`)
+
+// 展开模板中的变量，没有定义的变量保持原样
+func expandTemplate(s string, vars map[string]interface{}) string {
+	if !strings.Contains(s, "%(") {
+		return s
+	}
+	return templatePattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := templatePattern.FindStringSubmatch(m)
+		value, ok := vars[sub[1]]
+		if !ok {
+			return m
+		}
+		return fmt.Sprintf("%"+sub[2], value)
+	})
+}
+
+/*
+Program 由同一份配置启动的多个进程实例(NumProcs)，在管理器中作为一个整体管理，
+每个进程实例的名称、参数、环境变量和日志文件按模板展开
+*/
+type Program struct {
+	Name      string
+	manager   *Manager
+	template  *ProcessPlus // 创建进程实例的模板，名称、参数等还没有展开
+	lock      sync.RWMutex
+	instances []string     // 进程实例的名称，按序号从小到大排列
+	scale     *ScaleStatus // 最近一次伸缩的进度
+}
+
+// Names 获取所有进程实例的名称
+func (that *Program) Names() []string {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	return append([]string(nil), that.instances...)
+}
+
+// Processes 获取所有进程实例
+func (that *Program) Processes() []IProc {
+	procs := make([]IProc, 0)
+	for _, name := range that.Names() {
+		if proc, found := that.manager.SearchProc(name); found {
+			procs = append(procs, proc)
+		}
+	}
+	return procs
+}
+
+// StartProc 启动所有进程实例，wait表示阻塞等待所有进程实例启动
+func (that *Program) StartProc(wait bool) {
+	var wg sync.WaitGroup
+	for _, proc := range that.Processes() {
+		wg.Add(1)
+		go func(p IProc) {
+			defer wg.Done()
+			p.StartProc(wait)
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// StopProc 停止所有进程实例，wait表示阻塞等待所有进程实例停止
+func (that *Program) StopProc(wait bool) {
+	var wg sync.WaitGroup
+	for _, proc := range that.Processes() {
+		wg.Add(1)
+		go func(p IProc) {
+			defer wg.Done()
+			p.StopProc(wait)
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// GetProcessInfo 获取所有进程实例的信息
+func (that *Program) GetProcessInfo() []*Info {
+	infos := make([]*Info, 0)
+	for _, proc := range that.Processes() {
+		infos = append(infos, proc.GetProcessInfo())
+	}
+	return infos
+}
+
+// 按模板展开进程的名称、参数、环境变量和日志文件，num为进程实例的序号
+func (that *ProcessPlus) expandInstance(program string, num int) {
+	vars := map[string]interface{}{"program_name": program, "process_num": num}
+	that.Program = program
+	that.ProcessNum = num
+	if len(that.ProcessName) > 0 {
+		that.Name = expandTemplate(that.ProcessName, vars)
+	}
+	that.Path = expandTemplate(that.Path, vars)
+	for i, arg := range that.Args {
+		that.Args[i] = expandTemplate(arg, vars)
+	}
+	that.Dir = expandTemplate(that.Dir, vars)
+	for k, v := range that.Environment.Map() {
+		if expanded := expandTemplate(v, vars); expanded != v {
+			that.Environment.Set(k, expanded)
+		}
+	}
+	that.StdoutLogfile = expandTemplate(that.StdoutLogfile, vars)
+	that.StderrLogfile = expandTemplate(that.StderrLogfile, vars)
+}
+
+// 日志文件没有使用%(process_num)时，在文件名的扩展名之前添加"_%(process_num)d"，以免多个进程实例写入同一个日志文件
+func (that *ProcessPlus) instanceLogfiles() {
+	that.StdoutLogfile = instanceLogfiles(that.StdoutLogfile)
+	that.StderrLogfile = instanceLogfiles(that.StderrLogfile)
+}
+
+func instanceLogfiles(logfiles string) string {
+	if len(logfiles) == 0 {
+		return logfiles
+	}
+	files := proclog.SplitFileNames(logfiles)
+	for i, f := range files {
+		if strings.Contains(f, "%(process_num)") {
+			continue
+		}
+		path, query := f, ""
+		if strings.HasPrefix(f, "file://") {
+			path = strings.TrimPrefix(f, "file://")
+			if pos := strings.Index(path, "?"); pos >= 0 {
+				path, query = path[:pos], path[pos:]
+			}
+		} else if u, err := proclog.ParseLogURL(f); err != nil || u.Scheme != "file" {
+			// 只处理本地文件，syslog、网络等日志输出可以共用
+			continue
+		}
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + "_%(process_num)d" + ext
+		if strings.HasPrefix(f, "file://") {
+			path = "file://" + path + query
+		}
+		files[i] = path
+	}
+	return strings.Join(files, ",")
+}
+
+// 根据模板进程克隆一个进程实例，num为进程实例的序号
+func (that *ProcessPlus) newInstance(num int) *ProcessPlus {
+	clone, _ := that.Clone()
+	proc := clone.(*ProcessPlus)
+	proc.expandInstance(that.Name, num)
+	return proc
+}
+
+// 根据模板进程创建NumProcs个进程实例，并作为一个程序加入管理器
+func (that *Manager) newProgram(tpl *ProcessPlus) (*ProcessPlus, error) {
+	if len(tpl.ProcessName) == 0 {
+		tpl.ProcessName = defaultProcessName
+	}
+	if !strings.Contains(tpl.ProcessName, "%(process_num)") {
+		return nil, gerror.Newf("程序[%s]的进程实例数大于1，进程名称模板[%s]必须包含%%(process_num)", tpl.Name, tpl.ProcessName)
+	}
+	tpl.instanceLogfiles()
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if _, found := that.programs[tpl.Name]; found {
+		return nil, gerror.Newf("程序[%s]已存在", tpl.Name)
+	}
+
+	procs := make([]*ProcessPlus, 0, tpl.NumProcs)
+	for i := 0; i < tpl.NumProcs; i++ {
+		proc := tpl.newInstance(tpl.NumProcsStart + i)
+		if _, found := that.Search(proc.Name); found {
+			return nil, gerror.Newf("进程[%s]已存在", proc.Name)
+		}
+		for _, p := range procs {
+			if p.Name == proc.Name {
+				return nil, gerror.Newf("程序[%s]的进程实例名称[%s]重复", tpl.Name, proc.Name)
+			}
+		}
+		procs = append(procs, proc)
+	}
+
+	program := &Program{Name: tpl.Name, manager: that, template: tpl}
+	for _, proc := range procs {
+		program.instances = append(program.instances, proc.Name)
+		that.Add(proc.Name, proc)
+	}
+	that.programs[tpl.Name] = program
+	return procs[0], nil
+}
+
+// GetProgram 获取多实例的程序
+func (that *Manager) GetProgram(name string) (*Program, bool) {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	program, found := that.programs[name]
+	return program, found
+}
+
+// GetAllPrograms 获取所有多实例的程序
+func (that *Manager) GetAllPrograms() []*Program {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	programs := make([]*Program, 0, len(that.programs))
+	for _, program := range that.programs {
+		programs = append(programs, program)
+	}
+	return programs
+}
+
+// RemoveProgram 从管理器中移除程序及其所有进程实例，不会停止进程
+func (that *Manager) RemoveProgram(name string) {
+	that.lock.Lock()
+	program, found := that.programs[name]
+	delete(that.programs, name)
+	that.lock.Unlock()
+	if found {
+		for _, instance := range program.Names() {
+			that.Remove(instance)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package processes
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]interface{}{"program_name": "worker", "process_num": 3}
+	cases := map[string]string{
+		"%(program_name)s_%(process_num)d":   "worker_3",
+		"%(program_name)s_%(process_num)02d": "worker_03",
+		"%(process_num)3d|%(process_num)-3d": "  3|3  ",
+		"%(process_num)x":                    "3",
+		"--port=80%(process_num)02d":         "--port=8003",
+		"%(unknown)s_%(process_num)d":        "%(unknown)s_3",
+		"%(program_name)":                    "%(program_name)",
+		"plain":                              "plain",
+		"":                                   "",
+	}
+	for in, want := range cases {
+		if got := expandTemplate(in, vars); got != want {
+			t.Fatalf("%q应该展开为%q，得到%q", in, want, got)
+		}
+	}
+}
+
+func TestNewProgram(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager()
+	first, err := manager.NewProcess("worker",
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"--id=%(process_num)d"}),
+		ProcNumProcs(3),
+		ProcNumProcsStart(1),
+		ProcEnvVar("WORKER_ID", "%(process_num)d"),
+		ProcStdoutLog(filepath.Join(dir, "worker.log"), ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "worker_01" {
+		t.Fatalf("应该返回第一个进程实例worker_01，得到%s", first.Name)
+	}
+	program, found := manager.GetProgram("worker")
+	if !found {
+		t.Fatalf("应该创建程序worker")
+	}
+	if names := program.Names(); !reflect.DeepEqual(names, []string{"worker_01", "worker_02", "worker_03"}) {
+		t.Fatalf("进程实例的名称按默认模板展开，得到%v", names)
+	}
+	value, _ := manager.SearchProc("worker_02")
+	p := value.(*ProcessPlus)
+	if p.Args[1] != "--id=2" || p.ProcessNum != 2 || p.Program != "worker" {
+		t.Fatalf("进程实例的参数应该按序号展开，得到%v %d %s", p.Args, p.ProcessNum, p.Program)
+	}
+	if env := p.Environment.Get("WORKER_ID"); env != "2" {
+		t.Fatalf("进程实例的环境变量应该按序号展开，得到%s", env)
+	}
+	if want := filepath.Join(dir, "worker_2.log"); p.StdoutLogfile != want {
+		t.Fatalf("没有使用序号的日志文件应该添加序号，期望%s，得到%s", want, p.StdoutLogfile)
+	}
+	if names, _ := manager.Resolve("worker"); len(names) != 3 {
+		t.Fatalf("程序名称应该解析为所有进程实例，得到%v", names)
+	}
+
+	// 实例数大于1时名称模板必须包含序号
+	if _, err = manager.NewProcess("api", ProcPath("/bin/sleep"), ProcNumProcs(2, "api")); err == nil {
+		t.Fatalf("名称模板没有%%(process_num)时应该返回错误")
+	}
+	if _, err = manager.NewProcess("worker", ProcPath("/bin/sleep"), ProcNumProcs(2)); err == nil {
+		t.Fatalf("程序已存在时应该返回错误")
+	}
+	// 进程实例的名称与已有进程相同时不创建程序
+	if _, err = manager.NewProcess("web_01", ProcPath("/bin/sleep")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = manager.NewProcess("web", ProcPath("/bin/sleep"), ProcNumProcs(2)); err == nil {
+		t.Fatalf("进程实例web_01已存在时应该返回错误")
+	}
+	if _, found = manager.GetProgram("web"); found {
+		t.Fatalf("创建失败时不应该添加程序")
+	}
+}
@@ -0,0 +1,136 @@
+package processes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// 就绪检查的间隔
+const readyCheckInterval = 200 * time.Millisecond
+
+// 就绪信号，每次启动进程时重新创建，进程通知已经就绪时打开
+type readyGate struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newReadyGate() *readyGate {
+	return &readyGate{ch: make(chan struct{})}
+}
+
+// 打开就绪信号，可以重复调用
+func (that *readyGate) open() {
+	that.once.Do(func() {
+		close(that.ch)
+	})
+}
+
+// 进程是否需要通过就绪信号(sd_notify或者ReadyPattern，而不是StartSecs)判断启动成功
+func (that *ProcessPlus) readyGated() bool {
+	return that.Notify || that.ReadyPattern != nil
+}
+
+// 标记进程已经就绪，状态从Starting变为Running
+func (that *ProcessPlus) markReady() {
+	that.Lock.RLock()
+	gate := that.ready
+	that.Lock.RUnlock()
+	if gate != nil {
+		gate.open()
+	}
+}
+
+// ReadyProbe 就绪探针，进程进入Running状态后周期执行，返回nil表示进程已经可以提供服务
+type ReadyProbe func(p *ProcessPlus) error
+
+// TCPProbe 能够建立到addr的TCP连接时表示进程已经就绪
+func TCPProbe(addr string) ReadyProbe {
+	return func(_ *ProcessPlus) error {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPProbe 请求url返回2xx或者3xx时表示进程已经就绪
+func HTTPProbe(url string) ReadyProbe {
+	client := &http.Client{Timeout: 2 * time.Second}
+	return func(_ *ProcessPlus) error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return gerror.Newf("就绪检查[%s]返回状态码%d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// ExecProbe 执行命令，退出码为0时表示进程已经就绪，命令最多执行5秒
+func ExecProbe(path string, args ...string) ReadyProbe {
+	return func(_ *ProcessPlus) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return exec.CommandContext(ctx, path, args...).Run()
+	}
+}
+
+/*
+WaitReady 等待进程进入Running状态，并且就绪探针(ReadyProbe)检查通过，没有设置探针时进入Running状态即为就绪；
+进程启动失败或者已经退出时立即返回错误，timeout小于等于0时使用ReadyTimeoutSecs
+*/
+func (that *ProcessPlus) WaitReady(timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = time.Duration(that.ReadyTimeoutSecs) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		that.Lock.RLock()
+		state := that.State
+		that.Lock.RUnlock()
+
+		switch state {
+		case Fatal:
+			return gerror.Newf("进程[%s]启动失败", that.Name)
+		case Stopped, Exited:
+			return gerror.Newf("进程[%s]已经退出，状态为%s", that.Name, state.ToString())
+		case Running:
+			if that.ReadyProbe == nil {
+				return nil
+			}
+			if lastErr = that.ReadyProbe(that); lastErr == nil {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if lastErr != nil {
+				return gerror.Wrapf(lastErr, "等待进程[%s]就绪超时", that.Name)
+			}
+			return gerror.Newf("等待进程[%s]就绪超时，当前状态为%s", that.Name, state.ToString())
+		}
+		time.Sleep(readyCheckInterval)
+	}
+}
+
+// 等待进程就绪，不是ProcessPlus的进程只检查是否进入Running状态
+func waitReady(proc IProc, timeout time.Duration) error {
+	if p, ok := proc.(*ProcessPlus); ok {
+		return p.WaitReady(timeout)
+	}
+	if info := proc.GetProcessInfo(); info.State != int(Running) {
+		return gerror.Newf("进程[%s]没有进入Running状态，当前状态为%s", info.Name, info.StateName)
+	}
+	return nil
+}
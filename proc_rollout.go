@@ -0,0 +1,331 @@
+package processes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+const (
+	EventRolloutBatchStarted  EventType = "ROLLOUT_BATCH_STARTED"  // 滚动重启开始重启一批进程
+	EventRolloutProgress      EventType = "ROLLOUT_PROGRESS"       // 滚动重启中一个进程重启成功或者失败
+	EventRolloutBatchFinished EventType = "ROLLOUT_BATCH_FINISHED" // 滚动重启的一批进程重启完成
+	EventRolloutPaused        EventType = "ROLLOUT_PAUSED"         // 滚动重启暂停
+	EventRolloutResumed       EventType = "ROLLOUT_RESUMED"        // 滚动重启恢复
+	EventRolloutAborted       EventType = "ROLLOUT_ABORTED"        // 滚动重启中止
+	EventRolloutFinished      EventType = "ROLLOUT_FINISHED"       // 滚动重启完成
+)
+
+// RolloutState 滚动重启的状态
+type RolloutState string
+
+const (
+	RolloutRunning  RolloutState = "running"  // 正在重启
+	RolloutPaused   RolloutState = "paused"   // 已暂停，等待Resume或者Abort
+	RolloutAborted  RolloutState = "aborted"  // 已中止
+	RolloutFinished RolloutState = "finished" // 已完成
+)
+
+// RolloutOptions 滚动重启的参数
+type RolloutOptions struct {
+	BatchSize      string        // 每批重启的进程数，如"2"，或者按比例，如"25%"，默认为1
+	MaxFailures    int           // 重启失败的进程数达到该值时暂停或者中止，默认为1
+	AbortOnFailure bool          // 失败数达到MaxFailures时中止滚动重启，默认为暂停
+	ReadyTimeout   time.Duration // 等待每个进程就绪的最长时间，默认使用进程的ReadyTimeoutSecs
+	BatchInterval  time.Duration // 一批进程就绪后，开始下一批之前的等待时间
+}
+
+// RolloutProgress 滚动重启的进度
+type RolloutProgress struct {
+	Target    string            `json:"target"`
+	State     RolloutState      `json:"state"`
+	Total     int               `json:"total"`     // 需要重启的进程数
+	BatchSize int               `json:"batchsize"` // 每批重启的进程数
+	Batches   int               `json:"batches"`   // 总批数
+	Batch     int               `json:"batch"`     // 当前批次，从1开始，还没有开始时为0
+	Restarted []string          `json:"restarted"` // 重启并且已经就绪的进程
+	Failed    map[string]string `json:"failed"`    // 重启失败的进程及失败原因
+	StartTime time.Time         `json:"starttime"`
+	EndTime   time.Time         `json:"endtime"`
+}
+
+// 复制一份进度，调用方需要持有Rollout.lock
+func (that *RolloutProgress) snapshot() *RolloutProgress {
+	progress := *that
+	progress.Restarted = append([]string(nil), that.Restarted...)
+	progress.Failed = make(map[string]string, len(that.Failed))
+	for name, reason := range that.Failed {
+		progress.Failed[name] = reason
+	}
+	return &progress
+}
+
+/*
+Rollout 一次滚动重启，按批次依次重启目标进程，每一批的进程都进入Running状态并且就绪后才开始下一批，
+可以通过Progress或者订阅ROLLOUT_*事件获取进度
+*/
+type Rollout struct {
+	manager  *Manager
+	opts     RolloutOptions
+	batches  [][]IProc
+	lock     sync.Mutex
+	cond     *sync.Cond
+	progress RolloutProgress
+	failures int // 开始或者最近一次恢复之后失败的进程数
+	done     chan struct{}
+	err      error
+}
+
+// 解析每批重启的进程数，支持整数和百分比，结果至少为1
+func parseBatchSize(batchSize string, total int) (int, error) {
+	batchSize = strings.TrimSpace(batchSize)
+	if len(batchSize) == 0 {
+		return 1, nil
+	}
+	size := 0
+	if strings.HasSuffix(batchSize, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(batchSize, "%"))
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, gerror.Newf("滚动重启的批次大小[%s]不合法", batchSize)
+		}
+		size = (total*percent + 99) / 100
+	} else {
+		n, err := strconv.Atoi(batchSize)
+		if err != nil || n <= 0 {
+			return 0, gerror.Newf("滚动重启的批次大小[%s]不合法", batchSize)
+		}
+		size = n
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size, nil
+}
+
+/*
+RollingRestart 滚动重启目标进程，targets的格式见Resolve，如"workers:*"或者标签选择器"@team=payments"；
+进程按优先级排序后按BatchSize分批，同一批的进程并发重启，等待它们进入Running状态并且就绪探针检查通过后才重启下一批，
+失败的进程数达到MaxFailures时暂停(或者中止)。方法立即返回，通过Rollout.Wait等待滚动重启结束
+*/
+func (that *Manager) RollingRestart(opts RolloutOptions, targets ...string) (*Rollout, error) {
+	procs, err := that.resolveAll(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(procs) == 0 {
+		return nil, gerror.Newf("没有找到要滚动重启的进程%v", targets)
+	}
+	size, err := parseBatchSize(opts.BatchSize, len(procs))
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 1
+	}
+
+	ordered := make([]IProc, 0, len(procs))
+	for _, band := range that.priorityBands(procs, false) {
+		ordered = append(ordered, band...)
+	}
+	batches := make([][]IProc, 0)
+	for i := 0; i < len(ordered); i += size {
+		end := i + size
+		if end > len(ordered) {
+			end = len(ordered)
+		}
+		batches = append(batches, ordered[i:end])
+	}
+
+	rollout := &Rollout{
+		manager: that,
+		opts:    opts,
+		batches: batches,
+		progress: RolloutProgress{
+			Target:    strings.Join(targets, ","),
+			State:     RolloutRunning,
+			Total:     len(ordered),
+			BatchSize: size,
+			Batches:   len(batches),
+			Failed:    make(map[string]string),
+			StartTime: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+	rollout.cond = sync.NewCond(&rollout.lock)
+	logger.Infof("开始滚动重启[%s]，共%d个进程，分%d批", rollout.progress.Target, len(ordered), len(batches))
+	go rollout.run()
+	return rollout, nil
+}
+
+// 发送滚动重启的事件
+func (that *Rollout) emit(eventType EventType, name string, message string) {
+	that.lock.Lock()
+	progress := that.progress.snapshot()
+	that.lock.Unlock()
+	that.manager.emit(Event{
+		Type:    eventType,
+		Name:    name,
+		Message: message,
+		Data:    map[string]interface{}{"target": progress.Target, "progress": progress},
+	})
+}
+
+// 暂停时阻塞等待恢复，返回false表示已经中止
+func (that *Rollout) waitRunnable() bool {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for that.progress.State == RolloutPaused {
+		that.cond.Wait()
+	}
+	return that.progress.State == RolloutRunning
+}
+
+// 重启一个进程并等待就绪
+func (that *Rollout) restart(proc IProc) error {
+	proc.StopProc(true)
+	proc.StartProc(true)
+	return waitReady(proc, that.opts.ReadyTimeout)
+}
+
+// 按批次执行滚动重启
+func (that *Rollout) run() {
+	target := that.progress.Target
+	for i, batch := range that.batches {
+		if !that.waitRunnable() {
+			break
+		}
+		that.lock.Lock()
+		that.progress.Batch = i + 1
+		that.lock.Unlock()
+		that.emit(EventRolloutBatchStarted, "", fmt.Sprintf("滚动重启[%s]开始第%d/%d批", target, i+1, len(that.batches)))
+
+		var wg sync.WaitGroup
+		for _, proc := range batch {
+			wg.Add(1)
+			go func(p IProc) {
+				defer wg.Done()
+				name := p.GetProcessInfo().Name
+				err := that.restart(p)
+				that.lock.Lock()
+				if err != nil {
+					that.progress.Failed[name] = err.Error()
+					that.failures++
+				} else {
+					that.progress.Restarted = append(that.progress.Restarted, name)
+				}
+				that.lock.Unlock()
+				if err != nil {
+					logger.Errorf("滚动重启[%s]时进程[%s]重启失败：%v", target, name, err)
+					that.emit(EventRolloutProgress, name, fmt.Sprintf("进程[%s]重启失败：%v", name, err))
+				} else {
+					that.emit(EventRolloutProgress, name, fmt.Sprintf("进程[%s]重启成功", name))
+				}
+			}(proc)
+		}
+		wg.Wait()
+		that.emit(EventRolloutBatchFinished, "", fmt.Sprintf("滚动重启[%s]第%d/%d批完成", target, i+1, len(that.batches)))
+
+		// 失败数达到阈值时暂停或者中止
+		that.lock.Lock()
+		exceeded := that.failures >= that.opts.MaxFailures && that.progress.State == RolloutRunning
+		that.lock.Unlock()
+		if exceeded {
+			if that.opts.AbortOnFailure {
+				that.Abort()
+			} else if i < len(that.batches)-1 {
+				// 最后一批之后没有需要暂停的批次，直接以失败结束
+				that.Pause()
+			}
+		}
+		if that.opts.BatchInterval > 0 && i < len(that.batches)-1 {
+			time.Sleep(that.opts.BatchInterval)
+		}
+	}
+
+	that.lock.Lock()
+	aborted := that.progress.State == RolloutAborted
+	if !aborted {
+		that.progress.State = RolloutFinished
+	}
+	that.progress.EndTime = time.Now()
+	failed := len(that.progress.Failed)
+	if aborted {
+		that.err = gerror.Newf("滚动重启[%s]已中止，%d个进程重启失败", target, failed)
+	} else if failed > 0 {
+		that.err = gerror.Newf("滚动重启[%s]完成，%d个进程重启失败", target, failed)
+	}
+	that.lock.Unlock()
+
+	if !aborted {
+		logger.Infof("滚动重启[%s]完成，%d个进程重启失败", target, failed)
+		that.emit(EventRolloutFinished, "", fmt.Sprintf("滚动重启[%s]完成，%d个进程重启失败", target, failed))
+	}
+	close(that.done)
+}
+
+// Pause 暂停滚动重启，正在重启的一批进程完成后不再开始下一批
+func (that *Rollout) Pause() {
+	that.lock.Lock()
+	if that.progress.State != RolloutRunning {
+		that.lock.Unlock()
+		return
+	}
+	that.progress.State = RolloutPaused
+	that.lock.Unlock()
+	logger.Infof("滚动重启[%s]已暂停", that.progress.Target)
+	that.emit(EventRolloutPaused, "", fmt.Sprintf("滚动重启[%s]已暂停", that.progress.Target))
+}
+
+// Resume 恢复暂停的滚动重启，失败计数重新开始计算
+func (that *Rollout) Resume() {
+	that.lock.Lock()
+	if that.progress.State != RolloutPaused {
+		that.lock.Unlock()
+		return
+	}
+	that.progress.State = RolloutRunning
+	that.failures = 0
+	that.cond.Broadcast()
+	that.lock.Unlock()
+	logger.Infof("滚动重启[%s]已恢复", that.progress.Target)
+	that.emit(EventRolloutResumed, "", fmt.Sprintf("滚动重启[%s]已恢复", that.progress.Target))
+}
+
+// Abort 中止滚动重启，正在重启的一批进程完成后不再开始下一批
+func (that *Rollout) Abort() {
+	that.lock.Lock()
+	if that.progress.State != RolloutRunning && that.progress.State != RolloutPaused {
+		that.lock.Unlock()
+		return
+	}
+	that.progress.State = RolloutAborted
+	that.cond.Broadcast()
+	that.lock.Unlock()
+	logger.Infof("滚动重启[%s]已中止", that.progress.Target)
+	that.emit(EventRolloutAborted, "", fmt.Sprintf("滚动重启[%s]已中止", that.progress.Target))
+}
+
+// Wait 阻塞等待滚动重启结束，中止或者有进程重启失败时返回错误
+func (that *Rollout) Wait() error {
+	<-that.done
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.err
+}
+
+// Done 滚动重启结束(完成或者中止)时关闭的channel
+func (that *Rollout) Done() <-chan struct{} {
+	return that.done
+}
+
+// Progress 获取滚动重启的进度
+func (that *Rollout) Progress() *RolloutProgress {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.progress.snapshot()
+}
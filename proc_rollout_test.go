@@ -0,0 +1,149 @@
+package processes
+
+import (
+	"testing"
+	"time"
+)
+
+// 用于测试滚动重启的进程，healthy为false时重启后不会进入Running状态
+type fakeProc struct {
+	name    string
+	healthy bool
+}
+
+func (that *fakeProc) StartProc(wait bool) {}
+
+func (that *fakeProc) StopProc(wait bool) {}
+
+func (that *fakeProc) GetProcessInfo() *Info {
+	if that.healthy {
+		return &Info{Name: that.name, State: int(Running), StateName: "Running"}
+	}
+	return &Info{Name: that.name, State: int(Fatal), StateName: "Fatal"}
+}
+
+func (that *fakeProc) Clone() (IProc, error) {
+	return &fakeProc{name: that.name, healthy: that.healthy}, nil
+}
+
+func newFakeManager(procs ...*fakeProc) *Manager {
+	manager := NewManager()
+	for _, p := range procs {
+		manager.Set(p.name, p)
+	}
+	return manager
+}
+
+func waitRollout(t *testing.T, rollout *Rollout) error {
+	t.Helper()
+	select {
+	case <-rollout.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("滚动重启没有结束，当前状态为%s", rollout.Progress().State)
+	}
+	return rollout.Wait()
+}
+
+// 等待滚动重启进入指定状态
+func waitRolloutState(t *testing.T, rollout *Rollout, state RolloutState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for rollout.Progress().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("滚动重启应该进入%s状态，当前状态为%s", state, rollout.Progress().State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseBatchSize(t *testing.T) {
+	cases := []struct {
+		batchSize string
+		total     int
+		want      int
+	}{
+		{"", 10, 1},
+		{"2", 10, 2},
+		{"25%", 10, 3},
+		{"10%", 3, 1},
+		{"100%", 4, 4},
+	}
+	for _, c := range cases {
+		size, err := parseBatchSize(c.batchSize, c.total)
+		if err != nil || size != c.want {
+			t.Fatalf("parseBatchSize(%q, %d)应该为%d，得到%d, %v", c.batchSize, c.total, c.want, size, err)
+		}
+	}
+	for _, batchSize := range []string{"0", "-1", "abc", "0%", "150%"} {
+		if _, err := parseBatchSize(batchSize, 10); err == nil {
+			t.Fatalf("批次大小%q不合法，应该返回错误", batchSize)
+		}
+	}
+}
+
+func TestRolloutFailureOnLastBatch(t *testing.T) {
+	manager := newFakeManager(&fakeProc{name: "a", healthy: true}, &fakeProc{name: "b"})
+	rollout, err := manager.RollingRestart(RolloutOptions{}, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = waitRollout(t, rollout); err == nil {
+		t.Fatalf("有进程重启失败时Wait应该返回错误")
+	}
+	progress := rollout.Progress()
+	if progress.State != RolloutFinished {
+		t.Fatalf("最后一批失败时应该以finished结束而不是暂停，得到%s", progress.State)
+	}
+	if len(progress.Restarted) != 1 || len(progress.Failed) != 1 {
+		t.Fatalf("应该有1个进程成功、1个进程失败，得到%v, %v", progress.Restarted, progress.Failed)
+	}
+}
+
+func TestRolloutPauseAndResume(t *testing.T) {
+	manager := newFakeManager(&fakeProc{name: "a"}, &fakeProc{name: "b", healthy: true})
+	rollout, err := manager.RollingRestart(RolloutOptions{}, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitRolloutState(t, rollout, RolloutPaused)
+	if progress := rollout.Progress(); progress.Batch != 1 || len(progress.Restarted) != 0 {
+		t.Fatalf("暂停时不应该开始下一批，得到第%d批，已重启%v", progress.Batch, progress.Restarted)
+	}
+	rollout.Resume()
+	if err = waitRollout(t, rollout); err == nil {
+		t.Fatalf("有进程重启失败时Wait应该返回错误")
+	}
+	progress := rollout.Progress()
+	if progress.State != RolloutFinished || len(progress.Restarted) != 1 || progress.Restarted[0] != "b" {
+		t.Fatalf("恢复后应该重启剩余的进程，得到%s, %v", progress.State, progress.Restarted)
+	}
+}
+
+func TestRolloutAbortOnFailure(t *testing.T) {
+	manager := newFakeManager(&fakeProc{name: "a"}, &fakeProc{name: "b", healthy: true})
+	rollout, err := manager.RollingRestart(RolloutOptions{AbortOnFailure: true}, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = waitRollout(t, rollout); err == nil {
+		t.Fatalf("中止时Wait应该返回错误")
+	}
+	progress := rollout.Progress()
+	if progress.State != RolloutAborted || len(progress.Restarted) != 0 {
+		t.Fatalf("中止后不应该继续重启，得到%s, %v", progress.State, progress.Restarted)
+	}
+}
+
+func TestRolloutSucceeds(t *testing.T) {
+	manager := newFakeManager(&fakeProc{name: "a", healthy: true}, &fakeProc{name: "b", healthy: true})
+	rollout, err := manager.RollingRestart(RolloutOptions{BatchSize: "50%"}, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = waitRollout(t, rollout); err != nil {
+		t.Fatal(err)
+	}
+	if progress := rollout.Progress(); progress.Batches != 2 || len(progress.Restarted) != 2 {
+		t.Fatalf("应该分2批重启2个进程，得到%d批，已重启%v", progress.Batches, progress.Restarted)
+	}
+}
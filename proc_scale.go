@@ -0,0 +1,201 @@
+package processes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+const (
+	EventScaleProgress EventType = "SCALE_PROGRESS" // 伸缩过程中启动或者停止了一个进程实例
+	EventScaleFinished EventType = "SCALE_FINISHED" // 伸缩完成
+)
+
+// ScaleStatus 程序伸缩的进度
+type ScaleStatus struct {
+	Program   string    `json:"program"`
+	From      int       `json:"from"`      // 伸缩前的进程实例数
+	Desired   int       `json:"desired"`   // 目标进程实例数
+	Started   []string  `json:"started"`   // 已经启动的进程实例
+	Stopped   []string  `json:"stopped"`   // 已经停止并移除的进程实例
+	Failed    []string  `json:"failed"`    // 启动失败的进程实例
+	Done      bool      `json:"done"`      // 是否已经完成
+	StartTime time.Time `json:"starttime"` // 开始伸缩的时间
+	EndTime   time.Time `json:"endtime"`   // 完成伸缩的时间
+}
+
+// 复制一份进度，调用方需要持有Program.lock
+func (that *ScaleStatus) snapshot() *ScaleStatus {
+	status := *that
+	status.Started = append([]string(nil), that.Started...)
+	status.Stopped = append([]string(nil), that.Stopped...)
+	status.Failed = append([]string(nil), that.Failed...)
+	return &status
+}
+
+// ScaleStatus 获取最近一次伸缩的进度，没有伸缩过时返回nil
+func (that *Program) ScaleStatus() *ScaleStatus {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	if that.scale == nil {
+		return nil
+	}
+	return that.scale.snapshot()
+}
+
+// 记录一个进程实例的伸缩结果，并发送进度事件
+func (that *Program) progress(name string, list *[]string, action string) {
+	that.lock.Lock()
+	*list = append(*list, name)
+	status := that.scale.snapshot()
+	that.lock.Unlock()
+
+	that.manager.emit(Event{
+		Type:    EventScaleProgress,
+		Name:    name,
+		Message: fmt.Sprintf("程序[%s]%s进程实例[%s]，目标实例数%d", that.Name, action, name, status.Desired),
+		Data:    map[string]interface{}{"program": that.Name, "action": action, "status": status},
+	})
+}
+
+/*
+把单进程转换为程序，原来的进程作为序号为NumProcsStart的实例，调用方需要持有Manager.lock；
+使用进程展开模板之前的配置作为程序的模板，没有使用%(process_num)的日志文件会添加序号，以免多个进程实例写入同一个文件
+*/
+func (that *Manager) programOf(proc *ProcessPlus) *Program {
+	source := proc
+	if proc.template != nil {
+		source = proc.template
+	}
+	clone, _ := source.Clone()
+	tpl := clone.(*ProcessPlus)
+	tpl.instanceLogfiles()
+	tpl.Name = proc.Program
+	if len(tpl.Name) == 0 {
+		tpl.Name = proc.Name
+	}
+	if len(tpl.ProcessName) == 0 {
+		tpl.ProcessName = defaultProcessName
+	}
+	program := &Program{Name: tpl.Name, manager: that, template: tpl, instances: []string{proc.Name}}
+	that.programs[program.Name] = program
+	return program
+}
+
+/*
+Scale 把程序(或者单个进程)的进程实例数调整为n，新的进程实例通过ProcessPlus.Clone创建，名称按序号添加后缀；
+扩容时启动新的进程实例，缩容时从序号最大的进程实例开始，按StopSignal的顺序平滑停止并从管理器中移除。
+n需要在NumProcsMin和NumProcsMax之间，同一个程序同时只能有一个伸缩操作，
+可以通过Program.ScaleStatus或者订阅SCALE_PROGRESS、SCALE_FINISHED事件获取进度，wait表示阻塞等待伸缩完成
+*/
+func (that *Manager) Scale(name string, n int, wait bool) (*Program, error) {
+	that.lock.Lock()
+	program, found := that.programs[name]
+	if !found {
+		value, ok := that.Search(name)
+		proc, isProc := value.(*ProcessPlus)
+		if !ok || !isProc {
+			that.lock.Unlock()
+			return nil, gerror.Newf("没有找到要伸缩的程序[%s]", name)
+		}
+		program = that.programOf(proc)
+	}
+	that.lock.Unlock()
+
+	tpl := program.template
+	if n < 0 || n < tpl.NumProcsMin || (tpl.NumProcsMax > 0 && n > tpl.NumProcsMax) {
+		return program, gerror.Newf("程序[%s]的进程实例数[%d]超出范围[%d,%d]", program.Name, n, tpl.NumProcsMin, tpl.NumProcsMax)
+	}
+
+	program.lock.Lock()
+	if program.scale != nil && !program.scale.Done {
+		program.lock.Unlock()
+		return program, gerror.Newf("程序[%s]正在伸缩", program.Name)
+	}
+	current := len(program.instances)
+	program.scale = &ScaleStatus{Program: program.Name, From: current, Desired: n, StartTime: time.Now()}
+
+	// 扩容时先创建进程实例并加入管理器，序号在当前最大序号的基础上递增
+	added := make([]*ProcessPlus, 0)
+	removed := make([]string, 0)
+	if n > current {
+		next := tpl.NumProcsStart
+		if current > 0 {
+			if last, ok := that.Search(program.instances[current-1]); ok {
+				if p, ok := last.(*ProcessPlus); ok {
+					next = p.ProcessNum + 1
+				}
+			}
+		}
+		for len(program.instances) < n {
+			proc := tpl.newInstance(next)
+			next++
+			if _, exist := that.Search(proc.Name); exist {
+				continue
+			}
+			program.instances = append(program.instances, proc.Name)
+			that.Add(proc.Name, proc)
+			added = append(added, proc)
+		}
+	} else if n < current {
+		removed = append(removed, program.instances[n:]...)
+	}
+	program.lock.Unlock()
+
+	logger.Infof("伸缩程序[%s]，进程实例数从%d调整为%d", program.Name, current, n)
+	run := func() {
+		var wg sync.WaitGroup
+		for _, proc := range added {
+			wg.Add(1)
+			go func(p *ProcessPlus) {
+				defer wg.Done()
+				p.StartProc(true)
+				p.Lock.RLock()
+				fatal := p.State == Fatal
+				p.Lock.RUnlock()
+				if fatal {
+					program.progress(p.Name, &program.scale.Failed, "启动失败")
+				} else {
+					program.progress(p.Name, &program.scale.Started, "启动")
+				}
+			}(proc)
+		}
+		// 从序号最大的进程实例开始依次停止
+		for i := len(removed) - 1; i >= 0; i-- {
+			if proc, ok := that.SearchProc(removed[i]); ok {
+				proc.StopProc(true)
+			}
+			that.Remove(removed[i])
+			program.lock.Lock()
+			for j, instance := range program.instances {
+				if instance == removed[i] {
+					program.instances = append(program.instances[:j], program.instances[j+1:]...)
+					break
+				}
+			}
+			program.lock.Unlock()
+			program.progress(removed[i], &program.scale.Stopped, "停止")
+		}
+		wg.Wait()
+
+		program.lock.Lock()
+		program.scale.Done = true
+		program.scale.EndTime = time.Now()
+		status := program.scale.snapshot()
+		program.lock.Unlock()
+		that.emit(Event{
+			Type:    EventScaleFinished,
+			Message: fmt.Sprintf("程序[%s]的进程实例数从%d调整为%d", program.Name, status.From, status.Desired),
+			Data:    map[string]interface{}{"program": program.Name, "status": status},
+		})
+	}
+	if wait {
+		run()
+	} else {
+		go run()
+	}
+	return program, nil
+}
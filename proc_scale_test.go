@@ -0,0 +1,58 @@
+package processes
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestScaleSingleProcessUsesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager()
+	p, err := manager.NewProcess("web",
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10%(process_num)d"}),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStdoutLog(filepath.Join(dir, "web.log"), ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Args[1] != "100" {
+		t.Fatalf("单进程的参数应该按序号0展开，得到%v", p.Args)
+	}
+
+	program, err := manager.Scale("web", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer program.StopProc(true)
+	value, found := manager.SearchProc("web_01")
+	if !found {
+		t.Fatalf("应该创建进程实例web_01，得到%v", program.Names())
+	}
+	instance := value.(*ProcessPlus)
+	if instance.Args[1] != "101" {
+		t.Fatalf("新的进程实例应该按模板展开参数，得到%v", instance.Args)
+	}
+	if want := filepath.Join(dir, "web_1.log"); instance.StdoutLogfile != want {
+		t.Fatalf("新的进程实例不应该与原进程共用日志文件，期望%s，得到%s", want, instance.StdoutLogfile)
+	}
+	if p.StdoutLogfile != filepath.Join(dir, "web.log") {
+		t.Fatalf("原进程的日志文件不应该改变，得到%s", p.StdoutLogfile)
+	}
+}
+
+func TestInstanceLogfiles(t *testing.T) {
+	cases := map[string]string{
+		"/var/log/app.log":                       "/var/log/app_%(process_num)d.log",
+		"file:///var/log/app.log?backups=3":      "file:///var/log/app_%(process_num)d.log?backups=3",
+		"/var/log/app_%(process_num)02d.log":     "/var/log/app_%(process_num)02d.log",
+		"/dev/stdout,syslog@udp://127.0.0.1:514": "/dev/stdout,syslog@udp://127.0.0.1:514",
+		"":                                       "",
+	}
+	for in, want := range cases {
+		if got := instanceLogfiles(in); got != want {
+			t.Fatalf("%s: 期望%s，得到%s", in, want, got)
+		}
+	}
+}
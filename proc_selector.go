@@ -0,0 +1,190 @@
+package processes
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// 标签名称和值允许的字符
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-/]+$`)
+
+// in和notin条件，如zone in (a,b)
+var setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// 选择器中一个条件的运算符
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+)
+
+// 选择器中的一个条件
+type selectorRequirement struct {
+	key      string
+	operator string
+	value    string
+	values   []string // in和notin的值列表
+}
+
+func (that *selectorRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[that.key]
+	switch that.operator {
+	case selectorEquals:
+		return ok && value == that.value
+	case selectorNotEquals:
+		return !ok || value != that.value
+	case selectorExists:
+		return ok
+	case selectorNotExists:
+		return !ok
+	case selectorIn:
+		return ok && that.contains(value)
+	case selectorNotIn:
+		return !ok || !that.contains(value)
+	}
+	return false
+}
+
+func (that *selectorRequirement) contains(value string) bool {
+	for _, v := range that.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Selector 标签选择器，多个条件之间用逗号分隔，所有条件都满足时匹配：
+
+	team=payments   标签team的值为payments
+	tier!=canary    没有标签tier，或者tier的值不为canary
+	env             存在标签env
+	!debug          不存在标签debug
+	zone in (a,b)   标签zone的值为a或者b
+	zone notin (a)  没有标签zone，或者zone的值不在列表中
+*/
+type Selector struct {
+	requirements []*selectorRequirement
+}
+
+// Matches 判断标签是否满足选择器，空的选择器匹配所有标签
+func (that *Selector) Matches(labels map[string]string) bool {
+	for _, r := range that.requirements {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector 解析标签选择器，如team=payments,tier!=canary,zone in (a,b)
+func ParseSelector(selector string) (*Selector, error) {
+	s := &Selector{}
+	parts, err := splitSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		r := &selectorRequirement{}
+		if m := setPattern.FindStringSubmatch(part); m != nil {
+			r.key, r.operator = m[1], m[2]
+			for _, v := range strings.Split(m[3], ",") {
+				v = strings.TrimSpace(v)
+				if !labelPattern.MatchString(v) {
+					return nil, gerror.Newf("选择器[%s]中的标签值[%s]不合法", selector, v)
+				}
+				r.values = append(r.values, v)
+			}
+		} else if strings.ContainsAny(part, "()") {
+			return nil, gerror.Newf("选择器[%s]中的条件[%s]不合法", selector, part)
+		} else if i := strings.Index(part, "!="); i >= 0 {
+			r.key, r.operator, r.value = part[:i], selectorNotEquals, part[i+2:]
+		} else if i = strings.Index(part, "=="); i >= 0 {
+			r.key, r.operator, r.value = part[:i], selectorEquals, part[i+2:]
+		} else if i = strings.Index(part, "="); i >= 0 {
+			r.key, r.operator, r.value = part[:i], selectorEquals, part[i+1:]
+		} else if strings.HasPrefix(part, "!") {
+			r.key, r.operator = part[1:], selectorNotExists
+		} else {
+			r.key, r.operator = part, selectorExists
+		}
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if !labelPattern.MatchString(r.key) {
+			return nil, gerror.Newf("选择器[%s]中的标签名称[%s]不合法", selector, r.key)
+		}
+		if len(r.value) > 0 && !labelPattern.MatchString(r.value) {
+			return nil, gerror.Newf("选择器[%s]中的标签值[%s]不合法", selector, r.value)
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	return s, nil
+}
+
+// 按逗号拆分选择器中的条件，括号内的逗号不拆分
+func splitSelector(selector string) ([]string, error) {
+	parts := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return nil, gerror.Newf("选择器[%s]中的括号不匹配", selector)
+		}
+	}
+	if depth != 0 {
+		return nil, gerror.Newf("选择器[%s]中的括号不匹配", selector)
+	}
+	return append(parts, selector[start:]), nil
+}
+
+// 操作目标中标签选择器的前缀，如"@team=payments,env"，与进程名称、程序名称和组名区分开
+const selectorPrefix = "@"
+
+// 判断操作目标是否为标签选择器，是则返回去掉前缀后的选择器
+func isSelector(target string) (string, bool) {
+	if strings.HasPrefix(target, selectorPrefix) {
+		return target[len(selectorPrefix):], true
+	}
+	return "", false
+}
+
+// Select 获取标签满足选择器的所有进程名称
+func (that *Manager) Select(selector string) ([]string, error) {
+	type labeled interface {
+		GetLabels() map[string]string
+	}
+	s, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	that.Iterator(func(name string, value interface{}) bool {
+		if proc, ok := value.(labeled); ok && s.Matches(proc.GetLabels()) {
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,92 @@
+package processes
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 带标签的测试进程
+type labeledFakeProc struct {
+	fakeProc
+	labels map[string]string
+}
+
+func (that *labeledFakeProc) GetLabels() map[string]string {
+	return that.labels
+}
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]string{"team": "payments", "tier": "canary", "zone": "b"}
+	cases := []struct {
+		selector string
+		want     bool
+	}{
+		{"team=payments", true},
+		{"team==payments", true},
+		{"team=search", false},
+		{"tier!=canary", false},
+		{"tier!=stable", true},
+		{"missing!=x", true},
+		{"team", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!team", false},
+		{"zone in (a,b)", true},
+		{"zone in (a, c)", false},
+		{"missing in (a)", false},
+		{"zone notin (a,c)", true},
+		{"zone notin (b)", false},
+		{"missing notin (a)", true},
+		{"team=payments, zone in (a,b), !debug", true},
+		{"team=payments,zone in (c)", false},
+		{"", true},
+	}
+	for _, c := range cases {
+		s, err := ParseSelector(c.selector)
+		if err != nil {
+			t.Fatalf("解析选择器%q失败：%v", c.selector, err)
+		}
+		if got := s.Matches(labels); got != c.want {
+			t.Fatalf("选择器%q匹配结果应该为%v，得到%v", c.selector, c.want, got)
+		}
+	}
+	for _, selector := range []string{"=x", "!", "a=b=c", "team in (a,", "zone in a,b)", "zone in (a,,b)", "a b", "team=pay ments"} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Fatalf("选择器%q不合法，应该返回错误", selector)
+		}
+	}
+}
+
+func TestResolveSelector(t *testing.T) {
+	manager := NewManager()
+	manager.Set("api", &labeledFakeProc{fakeProc: fakeProc{name: "api"}, labels: map[string]string{"env": "prod"}})
+	manager.Set("worker", &labeledFakeProc{fakeProc: fakeProc{name: "worker"}, labels: map[string]string{"env": "dev", "debug": "1"}})
+	manager.Set("env", &labeledFakeProc{fakeProc: fakeProc{name: "env"}})
+
+	cases := []struct {
+		target string
+		want   []string
+	}{
+		// 不带前缀的为进程名称，即使与标签名称相同
+		{"env", []string{"env"}},
+		{"@env", []string{"api", "worker"}},
+		{"@!debug", []string{"api", "env"}},
+		{"@env=prod", []string{"api"}},
+		{"@env in (prod,dev),debug", []string{"worker"}},
+	}
+	for _, c := range cases {
+		names, err := manager.Resolve(c.target)
+		if err != nil {
+			t.Fatalf("解析%q失败：%v", c.target, err)
+		}
+		if !reflect.DeepEqual(names, c.want) {
+			t.Fatalf("%q应该解析为%v，得到%v", c.target, c.want, names)
+		}
+	}
+	if _, err := manager.Resolve("env=prod"); err == nil {
+		t.Fatalf("不带前缀时env=prod应该作为进程名称，找不到时返回错误")
+	}
+	if _, err := manager.NewGroup("@web", 1); err == nil {
+		t.Fatalf("进程组名称不能以选择器前缀开头")
+	}
+}
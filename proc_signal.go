@@ -3,6 +3,7 @@ package processes
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
 
 	"github.com/moqsien/processes/logger"
 	"github.com/moqsien/processes/signals"
@@ -38,6 +39,10 @@ func (that *ProcessPlus) SendSignals(sigs []string, sigChildren bool) {
 // sig: 要发送的信号
 // sigChildren: 如果为true，则信号会发送到该进程的子进程
 func (that *ProcessPlus) SendSignal(sig os.Signal, sigChildren bool) error {
+	if pid := atomic.LoadInt32(&that.mainPid); pid > 0 {
+		logger.Infof("发送信号[%s]到进程[%s]的主进程[%d]", sig, that.Name, pid)
+		return signals.KillPid(int(pid), sig, sigChildren)
+	}
 	if that.Cmd != nil && that.Process != nil {
 		logger.Infof("发送信号[%s]到进程[%s]", sig, that.Name)
 		err := signals.Kill(that.Process, sig, sigChildren)
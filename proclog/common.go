@@ -89,8 +89,8 @@ func ToSyslogFacility(facility string) syslog.Priority {
 // parse the configuration for syslog, it should be in following format:
 // [protocol:]host[:port]
 //
-// - protocol, could be tcp or udp, assuming udp as default
-// - port, if missing, by default for tcp is 6514 and for udp - 514
+// - protocol, could be tcp, udp or tls, assuming udp as default
+// - port, if missing, by default for tcp and udp is 514 and for tls - 6514 (RFC 5425)
 func ParseSysLogConfig(config string) (protocol string, host string, port int, err error) {
 	fields := strings.Split(config, ":")
 	host = ""
@@ -107,6 +107,10 @@ func ParseSysLogConfig(config string) (protocol string, host string, port int, e
 		case "tcp":
 			host = fields[1]
 			protocol = "tcp"
+			port = 514
+		case "tls":
+			host = fields[1]
+			protocol = "tls"
 			port = 6514
 		case "udp":
 			host = fields[1]
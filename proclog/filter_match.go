@@ -0,0 +1,54 @@
+package proclog
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+)
+
+/*
+MatchFilter 按行匹配日志内容的过滤器，不修改日志内容，第一次有行匹配pattern时调用onMatch，之后不再匹配，
+用于根据进程输出(如"listening on .*:8080")判断进程是否已经就绪
+*/
+type MatchFilter struct {
+	lock    sync.Mutex
+	pattern *regexp.Regexp
+	onMatch func(line []byte)
+	lines   lineBuffer // 按行拆分写入的内容
+	matched bool
+}
+
+// NewMatchFilter 创建按行匹配的过滤器
+func NewMatchFilter(pattern *regexp.Regexp, onMatch func(line []byte)) *MatchFilter {
+	return &MatchFilter{pattern: pattern, onMatch: onMatch}
+}
+
+func (that *MatchFilter) Filter(p []byte) []byte {
+	that.lock.Lock()
+	if that.matched {
+		that.lock.Unlock()
+		return p
+	}
+	var line []byte
+	for _, l := range that.lines.split(p) {
+		if that.pattern.Match(trimLine(l)) {
+			line = append([]byte{}, bytes.TrimSuffix(l, []byte{'\n'})...)
+			that.matched = true
+			that.lines = lineBuffer{}
+			break
+		}
+	}
+	that.lock.Unlock()
+
+	if line != nil && that.onMatch != nil {
+		that.onMatch(line)
+	}
+	return p
+}
+
+// Matched 是否已经有行匹配
+func (that *MatchFilter) Matched() bool {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.matched
+}
@@ -0,0 +1,38 @@
+package proclog
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMatchFilterSplitWrites(t *testing.T) {
+	calls := 0
+	var matched string
+	f := NewMatchFilter(regexp.MustCompile(`^listening on .*:8080$`), func(line []byte) {
+		calls++
+		matched = string(line)
+	})
+
+	writes := []string{"starting\nlisten", "ing on 0.0.0.0", ":8080\r\nlistening on 0.0.0.0:8080\n", "done\n"}
+	for _, w := range writes {
+		if out := f.Filter([]byte(w)); string(out) != w {
+			t.Fatalf("过滤器不应该修改日志内容，期望%q，得到%q", w, out)
+		}
+	}
+	if !f.Matched() || calls != 1 {
+		t.Fatalf("分多次写入的行应该匹配并且只回调一次，匹配%v，回调%d次", f.Matched(), calls)
+	}
+	if matched != "listening on 0.0.0.0:8080\r" {
+		t.Fatalf("回调的内容应该为匹配的行，得到%q", matched)
+	}
+}
+
+func TestMatchFilterNoMatch(t *testing.T) {
+	calls := 0
+	f := NewMatchFilter(regexp.MustCompile(`ready`), func([]byte) { calls++ })
+	f.Filter([]byte("not re"))
+	f.Filter([]byte("\nady\n"))
+	if f.Matched() || calls != 0 {
+		t.Fatalf("跨越换行符的内容不应该匹配，匹配%v，回调%d次", f.Matched(), calls)
+	}
+}
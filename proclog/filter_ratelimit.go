@@ -0,0 +1,157 @@
+package proclog
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+RateLimitFilter 令牌桶日志限流过滤器，按每秒行数和每秒字节数限流，桶的容量为1秒的量。
+被丢弃的日志不会写入，而是每隔一段时间写入一行"N lines suppressed"的汇总；
+之后没有新的日志时，汇总通过Flush在间隔结束时或者日志关闭时写入
+*/
+type RateLimitFilter struct {
+	lock        sync.Mutex
+	linesPerSec float64 // 每秒行数，0表示不限制
+	bytesPerSec float64 // 每秒字节数，0表示不限制
+	lineTokens  float64
+	byteTokens  float64
+	last        time.Time
+
+	interval      time.Duration // 汇总行的最小间隔
+	lastSummary   time.Time
+	windowLines   int64 // 上一次汇总之后丢弃的行数
+	windowBytes   int64 // 上一次汇总之后丢弃的字节数
+	midLine       bool  // 上一次写入的最后一行是否不完整
+	midLineAllows bool  // 不完整的行是否允许写入
+
+	suppressedLines int64 // 总共丢弃的行数
+	suppressedBytes int64 // 总共丢弃的字节数
+}
+
+// 补充令牌
+func (that *RateLimitFilter) refill(now time.Time) {
+	elapsed := now.Sub(that.last).Seconds()
+	that.last = now
+	if that.linesPerSec > 0 {
+		that.lineTokens += elapsed * that.linesPerSec
+		if that.lineTokens > that.linesPerSec {
+			that.lineTokens = that.linesPerSec
+		}
+	}
+	if that.bytesPerSec > 0 {
+		that.byteTokens += elapsed * that.bytesPerSec
+		if that.byteTokens > that.bytesPerSec {
+			that.byteTokens = that.bytesPerSec
+		}
+	}
+}
+
+// 判断一行是否允许写入，字节令牌允许透支，以免超长的行永远无法写入
+func (that *RateLimitFilter) allow(n int) bool {
+	if that.linesPerSec > 0 && that.lineTokens < 1 {
+		return false
+	}
+	if that.bytesPerSec > 0 && that.byteTokens <= 0 {
+		return false
+	}
+	that.lineTokens--
+	that.byteTokens -= float64(n)
+	return true
+}
+
+func (that *RateLimitFilter) Filter(p []byte) []byte {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	now := time.Now()
+	that.refill(now)
+
+	// 先写入之前丢弃的日志的汇总，再写入本次允许的日志
+	out := append(make([]byte, 0, len(p)), that.summary(now, false)...)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		line := p
+		if i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+
+		var allowed bool
+		if that.midLine {
+			// 同一行的后续内容沿用该行的结果，不重复计数
+			allowed = that.midLineAllows
+			if allowed {
+				that.byteTokens -= float64(len(line))
+			}
+		} else {
+			allowed = that.allow(len(line))
+			if !allowed {
+				that.windowLines++
+				atomic.AddInt64(&that.suppressedLines, 1)
+			}
+		}
+		if allowed {
+			out = append(out, line...)
+		} else {
+			that.windowBytes += int64(len(line))
+			atomic.AddInt64(&that.suppressedBytes, int64(len(line)))
+		}
+		that.midLine = i < 0
+		that.midLineAllows = allowed
+	}
+	return out
+}
+
+/*
+生成上一次汇总之后丢弃的日志的汇总行，没有丢弃或者距上一次汇总不足interval时返回nil；
+final为true时忽略间隔，如果最后一行不完整，先补一个换行符
+*/
+func (that *RateLimitFilter) summary(now time.Time, final bool) []byte {
+	if that.windowLines == 0 {
+		return nil
+	}
+	if !final && (that.midLine || now.Sub(that.lastSummary) < that.interval) {
+		return nil
+	}
+	out := make([]byte, 0, 80)
+	if that.midLine && that.midLineAllows {
+		out = append(out, '\n')
+	}
+	that.midLine = false
+	out = append(out, fmt.Sprintf("[processes] %d lines (%d bytes) suppressed by log rate limit\n", that.windowLines, that.windowBytes)...)
+	that.windowLines = 0
+	that.windowBytes = 0
+	that.lastSummary = now
+	return out
+}
+
+// Flush 之后没有新的日志时，在间隔结束时或者日志关闭时输出丢弃的日志的汇总
+func (that *RateLimitFilter) Flush(final bool) []byte {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.summary(time.Now(), final)
+}
+
+// Suppressed 获取总共丢弃的行数和字节数
+func (that *RateLimitFilter) Suppressed() (lines int64, bytes int64) {
+	return atomic.LoadInt64(&that.suppressedLines), atomic.LoadInt64(&that.suppressedBytes)
+}
+
+// NewRateLimitFilter 创建限流过滤器，linesPerSec和bytesPerSec为0表示不限制，interval为汇总行的最小间隔
+func NewRateLimitFilter(linesPerSec int, bytesPerSec int, interval time.Duration) *RateLimitFilter {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &RateLimitFilter{
+		linesPerSec: float64(linesPerSec),
+		bytesPerSec: float64(bytesPerSec),
+		lineTokens:  float64(linesPerSec),
+		byteTokens:  float64(bytesPerSec),
+		last:        time.Now(),
+		interval:    interval,
+	}
+}
@@ -0,0 +1,35 @@
+package proclog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitFilterFlushSummary(t *testing.T) {
+	f := NewRateLimitFilter(1, 0, 50*time.Millisecond)
+	f.lastSummary = time.Now()
+	if out := f.Filter([]byte("a\nb\nc\n")); string(out) != "a\n" {
+		t.Fatalf("每秒1行时只应该写入第一行，得到%q", out)
+	}
+	if out := f.Flush(false); len(out) != 0 {
+		t.Fatalf("间隔没有结束时不应该输出汇总，得到%q", out)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if out := f.Flush(false); !strings.Contains(string(out), "2 lines (4 bytes) suppressed") {
+		t.Fatalf("间隔结束后应该输出汇总，得到%q", out)
+	}
+	if out := f.Flush(true); len(out) != 0 {
+		t.Fatalf("汇总已经输出，得到%q", out)
+	}
+}
+
+func TestFilterLoggerSummaryOnClose(t *testing.T) {
+	sink := &memLogger{}
+	l := NewFilterLogger(sink, NewRateLimitFilter(1, 0, time.Hour))
+	_, _ = l.Write([]byte("a\nb\n"))
+	_ = l.Close()
+	if want := "a\n[processes] 1 lines (2 bytes) suppressed by log rate limit\n"; sink.String() != want {
+		t.Fatalf("关闭时应该写入最后的汇总，期望%q，得到%q", want, sink.String())
+	}
+}
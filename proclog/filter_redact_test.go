@@ -0,0 +1,77 @@
+package proclog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedactFilterSplitWrites(t *testing.T) {
+	f := NewRedactFilter(true)
+	out := f.Filter([]byte("login ok\nconnect postgres://admin:s3cr"))
+	if string(out) != "login ok\n" {
+		t.Fatalf("完整的行应该立即输出，不完整的行应该缓存，得到%q", out)
+	}
+	out = f.Filter([]byte("et@db:5432/app\n"))
+	if want := "connect postgres://admin:[REDACTED]@db:5432/app\n"; string(out) != want {
+		t.Fatalf("分两次写入的密码没有脱敏，期望%q，得到%q", want, out)
+	}
+	if f.Count() != 1 {
+		t.Fatalf("脱敏次数应该为1，得到%d", f.Count())
+	}
+}
+
+func TestRedactFilterFlush(t *testing.T) {
+	rule, err := NewRedactRule("token", `tok_[a-z0-9]+`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewRedactFilter(false, rule)
+	if out := f.Filter([]byte("using tok_abc123")); len(out) != 0 {
+		t.Fatalf("没有换行符的内容应该缓存，得到%q", out)
+	}
+	if out := f.Flush(false); len(out) != 0 {
+		t.Fatalf("缓存时间不足时不应该输出，得到%q", out)
+	}
+	if out := f.Flush(true); string(out) != "using [REDACTED]" {
+		t.Fatalf("关闭时应该输出脱敏后的缓存内容，得到%q", out)
+	}
+	if out := f.Flush(true); len(out) != 0 {
+		t.Fatalf("缓存已经输出，得到%q", out)
+	}
+}
+
+func TestRedactFilterPartialAge(t *testing.T) {
+	f := NewRedactFilter(false)
+	_ = f.Filter([]byte("first"))
+	f.lines.since = time.Now().Add(-2 * partialLineAge)
+	// 原来的不完整行已经输出，剩余的内容应该重新计时
+	if out := f.Filter([]byte(" line\nsecond")); string(out) != "first line\n" {
+		t.Fatalf("应该输出拼接后的完整行，得到%q", out)
+	}
+	if out := f.Flush(false); len(out) != 0 {
+		t.Fatalf("新的不完整行缓存时间不足，不应该输出，得到%q", out)
+	}
+
+	// 继续拼接同一行时保持原来的计时
+	f.lines.since = time.Now().Add(-2 * partialLineAge)
+	_ = f.Filter([]byte(" part"))
+	if out := f.Flush(false); string(out) != "second part" {
+		t.Fatalf("缓存超时的不完整行应该输出，得到%q", out)
+	}
+	if !f.lines.since.IsZero() {
+		t.Fatalf("输出缓存后应该清除计时")
+	}
+}
+
+func TestFilterLoggerFlushOnClose(t *testing.T) {
+	sink := &memLogger{}
+	l := NewFilterLogger(sink, NewRedactFilter(true))
+	_, _ = l.Write([]byte("line1\npassword=hunter2"))
+	if sink.String() != "line1\n" {
+		t.Fatalf("不完整的行不应该写入，得到%q", sink.String())
+	}
+	_ = l.Close()
+	if want := "line1\npassword=[REDACTED]"; sink.String() != want {
+		t.Fatalf("关闭时应该写入缓存的内容，期望%q，得到%q", want, sink.String())
+	}
+}
@@ -0,0 +1,62 @@
+package proclog
+
+import (
+	"bytes"
+	"time"
+)
+
+// 不完整的行超过该长度时，直接作为一行处理
+const maxPartialLine = 64 * 1024
+
+// 不完整的行缓存超过该时间后，非最终的flush也会输出它，以免提示符等没有换行符的内容一直不输出
+var partialLineAge = time.Second
+
+/*
+按行处理日志的缓冲：把写入的内容拆分为完整的行，没有换行符的内容缓存起来，与之后写入的内容拼成完整的行；
+不完整的行超过maxPartialLine时直接作为一行输出。lineBuffer本身不加锁，由使用方加锁
+*/
+type lineBuffer struct {
+	partial []byte    // 还没有换行符的内容
+	since   time.Time // partial开始缓存的时间
+}
+
+// 拼接缓存的内容和p，返回所有完整的行，每一行保留行尾的换行符，剩余的内容继续缓存
+func (that *lineBuffer) split(p []byte) [][]byte {
+	continued := len(that.partial) > 0
+	data := append(that.partial, p...)
+	that.partial = nil
+	lines := make([][]byte, 0)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			if len(data) < maxPartialLine {
+				// 原来缓存的内容已经作为完整的行输出时，剩余的内容是新的不完整行，重新计时
+				if len(lines) > 0 || !continued {
+					that.since = time.Now()
+				}
+				that.partial = append([]byte{}, data...)
+				break
+			}
+			i = len(data)
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+// 返回缓存的不完整行，final为false时只返回缓存超过partialLineAge的内容
+func (that *lineBuffer) flush(final bool) []byte {
+	if len(that.partial) == 0 || (!final && time.Since(that.since) < partialLineAge) {
+		return nil
+	}
+	line := that.partial
+	that.partial = nil
+	that.since = time.Time{}
+	return line
+}
+
+// 去掉行尾的换行符和\r
+func trimLine(line []byte) []byte {
+	return bytes.TrimRight(bytes.TrimSuffix(line, []byte{'\n'}), "\r")
+}
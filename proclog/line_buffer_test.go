@@ -0,0 +1,60 @@
+package proclog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLineBufferSplit(t *testing.T) {
+	var lb lineBuffer
+	if lines := lb.split([]byte("par")); len(lines) != 0 {
+		t.Fatalf("没有换行符的内容应该缓存，得到%q", lines)
+	}
+	lines := lb.split([]byte("tial\r\nsecond\nthird"))
+	if want := [][]byte{[]byte("partial\r\n"), []byte("second\n")}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("应该拼接缓存的内容并按行拆分，得到%q", lines)
+	}
+	if got := trimLine(lines[0]); string(got) != "partial" {
+		t.Fatalf("trimLine应该去掉行尾的\\r\\n，得到%q", got)
+	}
+	if line := lb.flush(true); string(line) != "third" {
+		t.Fatalf("最终flush应该返回缓存的内容，得到%q", line)
+	}
+	if line := lb.flush(true); line != nil {
+		t.Fatalf("缓存已经输出，得到%q", line)
+	}
+}
+
+func TestLineBufferLongLine(t *testing.T) {
+	var lb lineBuffer
+	long := bytes.Repeat([]byte("x"), maxPartialLine)
+	lines := lb.split(long)
+	if len(lines) != 1 || len(lines[0]) != maxPartialLine {
+		t.Fatalf("超长的不完整行应该直接作为一行，得到%d行", len(lines))
+	}
+	if line := lb.flush(true); line != nil {
+		t.Fatalf("超长的行不应该缓存，得到%d字节", len(line))
+	}
+}
+
+func TestLineBufferFlushAge(t *testing.T) {
+	var lb lineBuffer
+	_ = lb.split([]byte("prompt> "))
+	if line := lb.flush(false); line != nil {
+		t.Fatalf("缓存时间不足时不应该输出，得到%q", line)
+	}
+	lb.since = time.Now().Add(-2 * partialLineAge)
+	_ = lb.split([]byte("more"))
+	if line := lb.flush(false); string(line) != "prompt> more" {
+		t.Fatalf("继续拼接同一行时应该保持原来的计时，得到%q", line)
+	}
+
+	_ = lb.split([]byte("old"))
+	lb.since = time.Now().Add(-2 * partialLineAge)
+	_ = lb.split([]byte("\nnew"))
+	if line := lb.flush(false); line != nil {
+		t.Fatalf("新的不完整行应该重新计时，得到%q", line)
+	}
+}
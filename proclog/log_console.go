@@ -0,0 +1,151 @@
+package proclog
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// 进程名称的颜色，按进程注册的顺序循环使用
+var consolePalette = []color.Attribute{
+	color.FgCyan,
+	color.FgYellow,
+	color.FgGreen,
+	color.FgMagenta,
+	color.FgBlue,
+	color.FgHiCyan,
+	color.FgHiYellow,
+	color.FgHiGreen,
+	color.FgHiMagenta,
+	color.FgHiBlue,
+}
+
+var (
+	defaultConsole     *ConsoleSink
+	defaultConsoleOnce sync.Once
+)
+
+// DefaultConsole 获取输出到管理进程标准输出的共享控制台
+func DefaultConsole() *ConsoleSink {
+	defaultConsoleOnce.Do(func() {
+		defaultConsole = NewConsoleSink(color.Output, !color.NoColor)
+	})
+	return defaultConsole
+}
+
+func init() {
+	RegisterSink("console", newConsoleSink)
+}
+
+// console:// 把日志输出到共享的控制台，每行前添加进程名称
+func newConsoleSink(programName string, _ *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+	return DefaultConsole().NewLogger(programName, props["stream"]), nil
+}
+
+/*
+ConsoleSink 多个进程共享的控制台输出(类似foreman)，每一行前添加补齐长度并着色的进程名称，
+所有进程的输出按整行写入，不同进程的输出不会在一行中间交错，标准错误的行使用"!"代替"|"标记
+*/
+type ConsoleSink struct {
+	lock   sync.Mutex
+	writer io.Writer
+	color  bool
+	width  int                     // 已注册的最长的进程名称的长度，用于对齐，之后注册更长的名称时会变宽
+	colors map[string]*color.Color // 每个进程名称使用的颜色
+}
+
+/*
+Register 预先注册进程名称，分配颜色并更新对齐的宽度；NewLogger也会注册进程名称，
+但在输出开始后才注册更长的名称会让之后的行变宽，因此应在进程启动前注册所有已知的进程名称
+*/
+func (that *ConsoleSink) Register(names ...string) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for _, name := range names {
+		if _, ok := that.colors[name]; ok {
+			continue
+		}
+		c := color.New(consolePalette[len(that.colors)%len(consolePalette)])
+		if that.color {
+			c.EnableColor()
+		} else {
+			c.DisableColor()
+		}
+		that.colors[name] = c
+		if len(name) > that.width {
+			that.width = len(name)
+		}
+	}
+}
+
+// 写入多个完整的行
+func (that *ConsoleSink) writeLines(name string, stderr bool, lines [][]byte) error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	marker := "|"
+	if stderr {
+		marker = "!"
+	}
+	prefix := that.colors[name].Sprintf("%-*s %s", that.width, name, marker)
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(prefix)
+		buf.WriteByte(' ')
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	_, err := that.writer.Write(buf.Bytes())
+	return err
+}
+
+// NewLogger 创建一个进程的控制台日志对象，stream为stderr时使用标准错误的标记
+func (that *ConsoleSink) NewLogger(name string, stream string) *ConsoleLogger {
+	that.Register(name)
+	return &ConsoleLogger{sink: that, name: name, stderr: stream == "stderr"}
+}
+
+// NewConsoleSink 创建控制台输出，enableColor表示是否为进程名称着色
+func NewConsoleSink(writer io.Writer, enableColor bool) *ConsoleSink {
+	return &ConsoleSink{writer: writer, color: enableColor, colors: make(map[string]*color.Color)}
+}
+
+// ConsoleLogger 一个进程的标准输出或者标准错误写入共享控制台的日志对象，按行缓冲
+type ConsoleLogger struct {
+	NullLogger
+	sink   *ConsoleSink
+	name   string
+	stderr bool
+	lock   sync.Mutex
+	lines  lineBuffer // 按行拆分写入的内容
+}
+
+func (that *ConsoleLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	lines := that.lines.split(p)
+	for i, line := range lines {
+		lines[i] = trimLine(line)
+	}
+	if len(lines) > 0 {
+		if err := that.sink.writeLines(that.name, that.stderr, lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close 输出剩余的不完整行
+func (that *ConsoleLogger) Close() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	line := that.lines.flush(true)
+	if line == nil {
+		return nil
+	}
+	return that.sink.writeLines(that.name, that.stderr, [][]byte{line})
+}
@@ -0,0 +1,93 @@
+package proclog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConsoleInterleaving(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewConsoleSink(&buf, false)
+	sink.Register("web", "worker")
+	loggers := []*ConsoleLogger{sink.NewLogger("web", "stdout"), sink.NewLogger("worker", "stdout")}
+
+	// 每次写入半行，两个进程的输出在行中间交替，控制台中每一行仍然是完整的
+	var wg sync.WaitGroup
+	for _, l := range loggers {
+		wg.Add(1)
+		go func(l *ConsoleLogger) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, _ = l.Write([]byte(fmt.Sprintf("%s line ", l.name)))
+				_, _ = l.Write([]byte(fmt.Sprintf("%d\n", i)))
+			}
+		}(l)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 200 {
+		t.Fatalf("应该输出200行，得到%d行", len(lines))
+	}
+	next := map[string]int{}
+	for _, line := range lines {
+		var name string
+		switch {
+		case strings.HasPrefix(line, "web    | web line "):
+			name = "web"
+		case strings.HasPrefix(line, "worker | worker line "):
+			name = "worker"
+		default:
+			t.Fatalf("行的内容不完整或者没有对齐: %q", line)
+		}
+		if want := fmt.Sprintf("line %d", next[name]); !strings.HasSuffix(line, want) {
+			t.Fatalf("进程[%s]的行顺序错误，期望%q，得到%q", name, want, line)
+		}
+		next[name]++
+	}
+}
+
+func TestConsoleStderrMarker(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewConsoleSink(&buf, false)
+	stdout := sink.NewLogger("app", "stdout")
+	stderr := sink.NewLogger("app", "stderr")
+	_, _ = stdout.Write([]byte("out\r\n"))
+	_, _ = stderr.Write([]byte("err\n"))
+	if s := buf.String(); s != "app | out\napp ! err\n" {
+		t.Fatalf("标准错误应该使用!标记，得到%q", s)
+	}
+}
+
+func TestConsolePartialLineOnClose(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewConsoleSink(&buf, false)
+	l := sink.NewLogger("app", "stdout")
+	_, _ = l.Write([]byte("done\nprompt> "))
+	if s := buf.String(); s != "app | done\n" {
+		t.Fatalf("不完整的行应该缓存，得到%q", s)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "app | done\napp | prompt> \n" {
+		t.Fatalf("Close时应该输出不完整的行，得到%q", s)
+	}
+	if err := l.Close(); err != nil || strings.Count(buf.String(), "prompt") != 1 {
+		t.Fatalf("再次Close不应该重复输出，得到%q, %v", buf.String(), err)
+	}
+}
+
+func TestConsoleRegisterFixesWidth(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewConsoleSink(&buf, false)
+	sink.Register("a", "longer")
+	_, _ = sink.NewLogger("a", "stdout").Write([]byte("first\n"))
+	_, _ = sink.NewLogger("longer", "stdout").Write([]byte("second\n"))
+	if s := buf.String(); s != "a      | first\nlonger | second\n" {
+		t.Fatalf("预先注册后列宽应该固定，得到%q", s)
+	}
+}
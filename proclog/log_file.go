@@ -1,9 +1,15 @@
 package proclog
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gogf/gf/errors/gerror"
 )
@@ -16,10 +22,33 @@ type FileLogger struct {
 	fileSize int64    // 每个文件的长度
 	file     *os.File // 文件句柄
 	locker   sync.Locker
+
+	timestamp bool // 是否在每行日志前添加时间戳
+	lineStart bool // 下一次写入是否处于行首
+
+	fileLock  sync.Mutex // 保护文件句柄，Reopen可能在其他goroutine中调用
+	lastCheck time.Time  // 上一次检查文件是否被移动或删除的时间
+	closed    bool       // 是否已经调用过Close
+	streamEnd int64      // 日志流的末尾偏移，用于外部滚动后修正起始偏移，-1表示还没有打开过文件
+
+	fileMode os.FileMode // 日志文件的权限，0表示使用0666(受umask影响)
+	dirMode  os.FileMode // 自动创建日志目录时使用的权限
+	uid      int         // 日志文件的所属用户，-1表示不修改
+	gid      int         // 日志文件的所属组，-1表示不修改
 }
 
-// 备份日志文件
+// 检查文件是否被移动或删除的最小间隔
+const fileCheckInterval = time.Second
+
+// 备份日志文件，最旧的备份文件被覆盖时，把它的长度累加到日志流的起始偏移中
 func (that *FileLogger) BackupFiles() {
+	oldest := that.name
+	if that.backups > 0 {
+		oldest = fmt.Sprintf("%s.%d", that.name, that.backups)
+	}
+	if info, err := os.Stat(oldest); err == nil && !info.IsDir() {
+		addLogBase(that.name, info.Size())
+	}
 	for i := that.backups - 1; i > 0; i-- {
 		src := fmt.Sprintf("%s.%d", that.name, i)
 		dest := fmt.Sprintf("%s.%d", that.name, i+1)
@@ -31,24 +60,165 @@ func (that *FileLogger) BackupFiles() {
 	_ = os.Rename(that.name, dest)
 }
 
-// 打开要写入的日志文件
+/*
+RemoveBackupFile 删除日志文件name的备份文件backup，backups为日志保留的备份份数；
+删除的是日志流中最旧的备份文件时，把它的长度累加到日志流的起始偏移中，RotatedReader已经读到的偏移保持不变，
+删除其他备份文件会使之后的偏移前移，调用方需要从最旧的备份文件开始删除
+*/
+func RemoveBackupFile(name string, backups int, backup string) error {
+	info, err := os.Stat(backup)
+	if err != nil {
+		return err
+	}
+	oldest := ""
+	for i := backups; i > 0; i-- {
+		if p := fmt.Sprintf("%s.%d", name, i); fileExists(p) {
+			oldest = p
+			break
+		}
+	}
+	if err = os.Remove(backup); err != nil {
+		return err
+	}
+	if backup == oldest {
+		addLogBase(name, info.Size())
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// ListBackupFiles 获取日志文件已存在的备份文件，按从新到旧的顺序排列(name.1, name.2 ...)
+func ListBackupFiles(name string) []string {
+	matches, _ := filepath.Glob(name + ".*")
+	indexes := make(map[string]int, len(matches))
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		i, err := strconv.Atoi(strings.TrimPrefix(m, name+"."))
+		if err != nil || i <= 0 {
+			continue
+		}
+		indexes[m] = i
+		backups = append(backups, m)
+	}
+	sort.Slice(backups, func(a, b int) bool {
+		return indexes[backups[a]] < indexes[backups[b]]
+	})
+	return backups
+}
+
+// 打开要写入的日志文件，日志目录不存在时自动创建
 func (that *FileLogger) OpenFile(trunc bool) error {
 	if that.file != nil {
 		_ = that.file.Close()
 	}
+	that.makeDir()
+	mode := that.fileMode
+	if mode == 0 {
+		mode = 0666
+	}
 	fileInfo, err := os.Stat(that.name)
 	if trunc || err != nil {
-		that.file, err = os.Create(that.name)
+		that.file, err = os.OpenFile(that.name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
 		that.fileSize = 0
 	} else {
 		that.fileSize = fileInfo.Size()
-		that.file, err = os.OpenFile(that.name, os.O_RDWR|os.O_APPEND, 0666)
+		that.file, err = os.OpenFile(that.name, os.O_RDWR|os.O_APPEND, mode)
 	}
 
 	if err != nil {
 		fmt.Printf("Fail to open log file --%s-- with error %v\n", that.name, err)
+		return err
 	}
-	return err
+	if err = that.applyPerm(); err != nil {
+		_ = that.file.Close()
+		that.file = nil
+		return err
+	}
+	if that.streamEnd < 0 {
+		that.streamEnd = logStreamEnd(that.name, that.backups)
+	}
+	return nil
+}
+
+// 创建日志目录，设置了所属用户时，新创建的各级目录也修改为该用户，已经存在的目录不修改
+func (that *FileLogger) makeDir() {
+	dir := filepath.Dir(that.name)
+	created := make([]string, 0)
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		created = append(created, d)
+	}
+	if err := os.MkdirAll(dir, that.dirMode); err != nil {
+		fmt.Printf("Fail to create log dir --%s-- with error %v\n", dir, err)
+		return
+	}
+	if that.uid < 0 && that.gid < 0 {
+		return
+	}
+	for _, d := range created {
+		if err := os.Chown(d, that.uid, that.gid); err != nil {
+			fmt.Printf("Fail to chown log dir --%s-- with error %v\n", d, err)
+		}
+	}
+}
+
+// 设置日志文件的权限和所属用户，文件已经存在时OpenFile不会修改它的权限
+func (that *FileLogger) applyPerm() error {
+	if that.fileMode != 0 {
+		if err := that.file.Chmod(that.fileMode); err != nil {
+			fmt.Printf("Fail to chmod log file --%s-- with error %v\n", that.name, err)
+			return err
+		}
+	}
+	if that.uid >= 0 || that.gid >= 0 {
+		if err := that.file.Chown(that.uid, that.gid); err != nil {
+			fmt.Printf("Fail to chown log file --%s-- with error %v\n", that.name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPerm 设置日志文件的权限和所属用户，mode为0表示不修改，uid和gid为-1表示不修改，会立即作用于当前的日志文件
+func (that *FileLogger) SetPerm(mode os.FileMode, uid int, gid int) error {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+	that.fileMode = mode
+	that.uid = uid
+	that.gid = gid
+	if that.file == nil {
+		return nil
+	}
+	return that.applyPerm()
+}
+
+// 在每一行的行首添加时间戳
+func (that *FileLogger) frame(p []byte) []byte {
+	ts := []byte(time.Now().Format(TimestampLayout) + " ")
+	buf := make([]byte, 0, len(p)+len(ts))
+	for len(p) > 0 {
+		if that.lineStart {
+			buf = append(buf, ts...)
+			that.lineStart = false
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			buf = append(buf, p...)
+			break
+		}
+		buf = append(buf, p[:i+1]...)
+		p = p[i+1:]
+		that.lineStart = true
+	}
+	return buf
 }
 
 // 日志文件写入
@@ -56,13 +226,31 @@ func (that *FileLogger) Write(p []byte) (int, error) {
 	that.locker.Lock()
 	defer that.locker.Unlock()
 
-	n, err := that.file.Write(p)
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+
+	that.checkFile()
+	if that.file == nil {
+		return 0, gerror.Newf("日志文件[%s]没有打开", that.name)
+	}
+	b := p
+	if that.timestamp {
+		b = that.frame(p)
+	}
+	n, err := that.file.Write(b)
+	if that.streamEnd >= 0 {
+		that.streamEnd += int64(n)
+	}
 
 	if err != nil {
+		if that.timestamp {
+			return 0, err
+		}
 		return n, err
 	}
 	//that.logEventEmitter.emitLogEvent(string(p))
 	that.fileSize += int64(n)
+	n = len(p)
 	if that.fileSize >= that.maxSize {
 		fileInfo, errStat := os.Stat(that.name)
 		if errStat == nil {
@@ -72,7 +260,7 @@ func (that *FileLogger) Write(p []byte) (int, error) {
 		}
 	}
 	if that.fileSize >= that.maxSize {
-		_ = that.Close()
+		_ = that.close()
 		that.BackupFiles()
 		_ = that.OpenFile(true)
 	}
@@ -81,6 +269,13 @@ func (that *FileLogger) Write(p []byte) (int, error) {
 
 // Close 关闭文件
 func (that *FileLogger) Close() error {
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+	that.closed = true
+	return that.close()
+}
+
+func (that *FileLogger) close() error {
 	if that.file != nil {
 		err := that.file.Close()
 		that.file = nil
@@ -89,14 +284,76 @@ func (that *FileLogger) Close() error {
 	return nil
 }
 
+/*
+Reopen 关闭并重新打开日志文件，用于配合外部的logrotate(create模式)：
+logrotate移动日志文件后，通知管理进程重新打开，后续的日志写入新创建的文件
+*/
+func (that *FileLogger) Reopen() error {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+	if that.closed {
+		return nil
+	}
+	that.lastCheck = time.Now()
+	return that.reopen()
+}
+
+/*
+重新打开被外部移动或删除的日志文件，调用方需要持有fileLock；
+日志流因此变短时(如logrotate删除或者压缩了备份文件)，把缺少的长度累加到起始偏移中，新写入的内容从原来的末尾偏移继续
+*/
+func (that *FileLogger) reopen() error {
+	end := that.streamEnd
+	err := that.OpenFile(false)
+	if end >= 0 {
+		if size := logStreamEnd(that.name, that.backups); size < end {
+			addLogBase(that.name, end-size)
+		}
+		that.streamEnd = logStreamEnd(that.name, that.backups)
+	}
+	return err
+}
+
+// 每隔fileCheckInterval比较一次当前打开的文件与文件路径的inode和设备号，文件被移动或删除时重新打开，调用方需要持有fileLock
+func (that *FileLogger) checkFile() {
+	now := time.Now()
+	if that.closed {
+		return
+	}
+	if that.file != nil && now.Sub(that.lastCheck) < fileCheckInterval {
+		return
+	}
+	that.lastCheck = now
+	if that.file != nil {
+		opened, err := that.file.Stat()
+		if err != nil {
+			return
+		}
+		if current, err := os.Stat(that.name); err == nil && os.SameFile(opened, current) {
+			return
+		}
+	}
+	_ = that.reopen()
+}
+
 func (that *FileLogger) SetPid(pid int) {
 	// NOTHING TO DO
 }
 
-// ClearCurLogFile 清除当前日志文件
+/*
+ClearCurLogFile 清除当前日志文件，清除的长度累加到日志流的起始偏移中，之后写入的内容从原来的末尾偏移继续；
+存在备份文件时，备份文件中的内容在日志流中的偏移会相应后移
+*/
 func (that *FileLogger) ClearCurLogFile() error {
 	that.locker.Lock()
 	defer that.locker.Unlock()
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+	if info, err := os.Stat(that.name); err == nil {
+		addLogBase(that.name, info.Size())
+	}
 	return that.OpenFile(true)
 }
 
@@ -104,17 +361,23 @@ func (that *FileLogger) ClearCurLogFile() error {
 func (that *FileLogger) ClearAllLogFile() error {
 	that.locker.Lock()
 	defer that.locker.Unlock()
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
 
 	for i := that.backups; i > 0; i-- {
 		logFile := fmt.Sprintf("%s.%d", that.name, i)
-		_, err := os.Stat(logFile)
+		info, err := os.Stat(logFile)
 		if err == nil {
+			addLogBase(that.name, info.Size())
 			err = os.Remove(logFile)
 			if err != nil {
 				return err
 			}
 		}
 	}
+	if info, err := os.Stat(that.name); err == nil {
+		addLogBase(that.name, info.Size())
+	}
 	err := that.OpenFile(true)
 	if err != nil {
 		return err
@@ -122,6 +385,24 @@ func (that *FileLogger) ClearAllLogFile() error {
 	return nil
 }
 
+// RemoveBackupFile 删除一个备份文件，持有文件锁，不会与日志的滚动同时进行，见RemoveBackupFile
+func (that *FileLogger) RemoveBackupFile(backup string) error {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	that.fileLock.Lock()
+	defer that.fileLock.Unlock()
+	err := RemoveBackupFile(that.name, that.backups, backup)
+	if that.streamEnd >= 0 {
+		that.streamEnd = logStreamEnd(that.name, that.backups)
+	}
+	return err
+}
+
+// Name 获取日志文件的名称
+func (that *FileLogger) Name() string {
+	return that.name
+}
+
 // ReadLog 读取日志
 func (that *FileLogger) ReadLog(offset int64, length int64) (string, error) {
 	if offset < 0 && length != 0 {
@@ -223,15 +504,39 @@ func (that *FileLogger) ReadTailLog(offset int64, length int64) (string, int64,
 	return string(b[:n]), offset + int64(n), false, nil
 }
 
+// SetTimestamp 设置是否在每行日志前添加时间戳，开启后可以通过RotatedReader按时间范围读取日志
+func (that *FileLogger) SetTimestamp(enable bool) {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	that.timestamp = enable
+}
+
+// Reader 获取跨备份文件读取日志的对象，只在获取文件列表时持有文件锁，读取文件内容时不会阻塞日志的写入和滚动
+func (that *FileLogger) Reader() *RotatedReader {
+	return &RotatedReader{name: that.name, backups: that.backups, locker: &that.fileLock}
+}
+
+// NewFileLogger 创建日志文件对象，并立即打开日志文件
 func NewFileLogger(fileName string, maxSize int64, backups int, locker sync.Locker) *FileLogger {
-	logger := &FileLogger{
-		name:     fileName,
-		maxSize:  maxSize,
-		backups:  backups,
-		fileSize: 0,
-		file:     nil,
-		locker:   locker,
-	}
+	logger := newFileLogger(fileName, maxSize, backups, locker)
 	_ = logger.OpenFile(false)
 	return logger
 }
+
+// 创建日志文件对象，但不打开日志文件
+func newFileLogger(fileName string, maxSize int64, backups int, locker sync.Locker) *FileLogger {
+	return &FileLogger{
+		name:      fileName,
+		maxSize:   maxSize,
+		backups:   backups,
+		fileSize:  0,
+		file:      nil,
+		locker:    locker,
+		lineStart: true,
+		lastCheck: time.Now(),
+		streamEnd: -1,
+		dirMode:   0755,
+		uid:       -1,
+		gid:       -1,
+	}
+}
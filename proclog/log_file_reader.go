@@ -0,0 +1,357 @@
+package proclog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/logger"
+)
+
+// TimestampLayout 开启时间戳后，每行日志前添加的时间格式，固定长度
+const TimestampLayout = "2006-01-02T15:04:05.000000-07:00"
+
+// ParseTimestamp 解析日志行首的时间戳，返回时间和去掉时间戳之后的内容
+func ParseTimestamp(line string) (time.Time, string, bool) {
+	if len(line) <= len(TimestampLayout) || line[len(TimestampLayout)] != ' ' {
+		return time.Time{}, line, false
+	}
+	t, err := time.Parse(TimestampLayout, line[:len(TimestampLayout)])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, line[len(TimestampLayout)+1:], true
+}
+
+// LogLine 日志中的一行
+type LogLine struct {
+	Number int64     // 行号，从1开始
+	Offset int64     // 该行在日志流中的全局偏移
+	Time   time.Time // 该行的时间戳，未开启时间戳时为零值，没有时间戳的行沿用上一行的时间
+	Text   string    // 该行的内容，不包含换行符和时间戳
+	Raw    string    // 该行的原始内容，不包含换行符
+}
+
+// 日志流中的一个文件
+type logSegment struct {
+	path    string
+	start   int64 // 该文件在日志流中的起始偏移
+	size    int64
+	modTime time.Time
+	file    *os.File // open打开的文件，滚动时文件被移动或者删除也可以继续读取
+}
+
+/*
+日志流的起始偏移保存在日志目录下的隐藏文件.<文件名>.offset中，即滚动和清除时已经删除的内容的总长度；
+使用隐藏文件是为了不被name.*或者*.log*之类的通配符匹配到，清理日志目录时不要删除该文件，否则偏移会从0重新开始
+*/
+func logBaseFile(name string) string {
+	return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".offset")
+}
+
+// 读取日志流的起始偏移，文件不存在时为0
+func readLogBase(name string) int64 {
+	b, err := os.ReadFile(logBaseFile(name))
+	if err != nil {
+		return 0
+	}
+	base, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || base < 0 {
+		return 0
+	}
+	return base
+}
+
+// 日志流开头的n个字节被删除，累加到起始偏移中
+func addLogBase(name string, n int64) {
+	if n <= 0 {
+		return
+	}
+	base := readLogBase(name) + n
+	if err := os.WriteFile(logBaseFile(name), []byte(strconv.FormatInt(base, 10)), 0644); err != nil {
+		logger.Errorf("写入日志偏移文件[%s]失败：%v", logBaseFile(name), err)
+	}
+}
+
+// 日志流当前的末尾偏移，即起始偏移加上所有日志文件的长度
+func logStreamEnd(name string, backups int) int64 {
+	segs := (&RotatedReader{name: name, backups: backups}).segments()
+	if len(segs) == 0 {
+		return readLogBase(name)
+	}
+	last := segs[len(segs)-1]
+	return last.start + last.size
+}
+
+/*
+RotatedReader 把当前日志文件和它的备份文件(name.N ... name.1, name)当作一个连续的日志流读取，
+偏移量为整个日志流中的全局偏移：日志滚动删除最旧的备份文件后，被删除的长度累加到起始偏移中，
+已经读到的偏移在滚动之后仍然指向同一行日志
+*/
+type RotatedReader struct {
+	name    string
+	backups int
+	locker  sync.Locker
+}
+
+// 按从旧到新的顺序获取所有存在的日志文件
+func (that *RotatedReader) segments() []*logSegment {
+	paths := make([]string, 0, that.backups+1)
+	for i := that.backups; i > 0; i-- {
+		paths = append(paths, fmt.Sprintf("%s.%d", that.name, i))
+	}
+	paths = append(paths, that.name)
+
+	segs := make([]*logSegment, 0, len(paths))
+	start := readLogBase(that.name)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		segs = append(segs, &logSegment{path: p, start: start, size: info.Size(), modTime: info.ModTime()})
+		start += info.Size()
+	}
+	return segs
+}
+
+/*
+持有锁获取日志流的快照：打开所有文件并记录它们的长度，然后释放锁，
+之后的读取不再持有锁，不会阻塞日志的写入；读取结束后需要调用closeSegments
+*/
+func (that *RotatedReader) open() []*logSegment {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	segs := that.segments()
+	opened := make([]*logSegment, 0, len(segs))
+	for _, seg := range segs {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			continue
+		}
+		seg.file = f
+		opened = append(opened, seg)
+	}
+	return opened
+}
+
+func closeSegments(segs []*logSegment) {
+	for _, seg := range segs {
+		if seg.file != nil {
+			_ = seg.file.Close()
+		}
+	}
+}
+
+// 日志流开头(最旧的文件)的全局偏移
+func streamStart(segs []*logSegment) int64 {
+	if len(segs) == 0 {
+		return 0
+	}
+	return segs[0].start
+}
+
+func totalSize(segs []*logSegment) int64 {
+	if len(segs) == 0 {
+		return 0
+	}
+	last := segs[len(segs)-1]
+	return last.start + last.size
+}
+
+// 从日志流中读取[offset, offset+length)范围的内容
+func readSegments(segs []*logSegment, offset int64, length int64) (string, error) {
+	var sb strings.Builder
+	for _, seg := range segs {
+		if length <= 0 {
+			break
+		}
+		if offset >= seg.start+seg.size {
+			continue
+		}
+		n := seg.start + seg.size - offset
+		if n > length {
+			n = length
+		}
+		b := make([]byte, n)
+		m, err := seg.file.ReadAt(b, offset-seg.start)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		sb.Write(b[:m])
+		offset += int64(m)
+		length -= int64(m)
+	}
+	return sb.String(), nil
+}
+
+// Name 获取当前日志文件的名称
+func (that *RotatedReader) Name() string {
+	return that.name
+}
+
+// Size 获取日志流末尾的全局偏移，即写入过的总长度(包括已经被滚动删除的内容)
+func (that *RotatedReader) Size() int64 {
+	that.locker.Lock()
+	defer that.locker.Unlock()
+	return totalSize(that.segments())
+}
+
+// ReadLog 读取日志流，参数的含义与FileLogger.ReadLog相同
+func (that *RotatedReader) ReadLog(offset int64, length int64) (string, error) {
+	if offset < 0 && length != 0 {
+		return "", gerror.New("BAD_ARGUMENTS")
+	}
+	if offset >= 0 && length < 0 {
+		return "", gerror.New("BAD_ARGUMENTS")
+	}
+	segs := that.open()
+	defer closeSegments(segs)
+	if len(segs) == 0 {
+		return "", gerror.New("NO_FILE")
+	}
+	streamLen := totalSize(segs)
+	start := streamStart(segs)
+	if offset < 0 {
+		offset = streamLen + offset
+		if offset < start {
+			offset = start
+		}
+		length = streamLen - offset
+	} else if offset < start {
+		// 已经被滚动删除的内容，从现存最旧的内容开始读
+		offset = start
+	}
+	if length == 0 {
+		if offset > streamLen {
+			return "", nil
+		}
+		length = streamLen - offset
+	} else {
+		if offset >= streamLen {
+			return "", nil
+		}
+		if offset+length > streamLen {
+			length = streamLen - offset
+		}
+	}
+	s, err := readSegments(segs, offset, length)
+	if err != nil {
+		return "", gerror.New("FAILED")
+	}
+	return s, nil
+}
+
+// ReadTailLog 从日志流的offset处读取日志，参数和返回值的含义与FileLogger.ReadTailLog相同
+func (that *RotatedReader) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
+	if offset < 0 {
+		return "", offset, false, fmt.Errorf("offset should not be less than 0")
+	}
+	if length < 0 {
+		return "", offset, false, fmt.Errorf("length should be not be less than 0")
+	}
+	segs := that.open()
+	defer closeSegments(segs)
+	if len(segs) == 0 {
+		return "", 0, false, gerror.New("NO_FILE")
+	}
+	streamLen := totalSize(segs)
+	if offset < streamStart(segs) {
+		offset = streamStart(segs)
+	}
+	if offset >= streamLen {
+		return "", streamLen, true, nil
+	}
+	if offset+length > streamLen {
+		length = streamLen - offset
+	}
+	s, err := readSegments(segs, offset, length)
+	if err != nil {
+		return "", offset, false, err
+	}
+	return s, offset + int64(len(s)), false, nil
+}
+
+// 逐行扫描日志流的快照，修改时间早于skipBefore的文件会被整个跳过，跳过文件之后的行号不再准确
+func (that *RotatedReader) scan(skipBefore time.Time, fn func(line *LogLine) bool) error {
+	segs := that.open()
+	defer closeSegments(segs)
+	var number int64
+	var lastTime time.Time
+	for _, seg := range segs {
+		if !skipBefore.IsZero() && seg.modTime.Before(skipBefore) {
+			continue
+		}
+		// 只读取快照时的长度，之后写入的内容留到下一次扫描
+		reader := bufio.NewReader(io.NewSectionReader(seg.file, 0, seg.size))
+		offset := seg.start
+		for {
+			text, err := reader.ReadString('\n')
+			if len(text) > 0 {
+				number++
+				line := &LogLine{Number: number, Offset: offset}
+				offset += int64(len(text))
+				text = strings.TrimRight(text, "\r\n")
+				line.Raw = text
+				if t, rest, ok := ParseTimestamp(text); ok {
+					lastTime = t
+					text = rest
+				}
+				line.Time = lastTime
+				line.Text = text
+				if !fn(line) {
+					return nil
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ScanLines 从旧到新逐行扫描整个日志流，fn返回false时停止扫描
+func (that *RotatedReader) ScanLines(fn func(line *LogLine) bool) error {
+	return that.scan(time.Time{}, fn)
+}
+
+// ReadSince 读取时间戳不早于t的日志，需要开启时间戳
+func (that *RotatedReader) ReadSince(t time.Time) (string, error) {
+	return that.ReadBetween(t, time.Time{})
+}
+
+// ReadBetween 读取时间戳在[t1, t2)范围内的日志，t2为零值表示不限制结束时间，需要开启时间戳
+func (that *RotatedReader) ReadBetween(t1, t2 time.Time) (string, error) {
+	if !t2.IsZero() && !t1.Before(t2) {
+		return "", gerror.New("BAD_ARGUMENTS")
+	}
+	var sb strings.Builder
+	err := that.scan(t1, func(line *LogLine) bool {
+		if line.Time.IsZero() || line.Time.Before(t1) {
+			return true
+		}
+		if !t2.IsZero() && !line.Time.Before(t2) {
+			return false
+		}
+		sb.WriteString(line.Raw)
+		sb.WriteByte('\n')
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// NewRotatedReader 创建跨备份文件读取日志的对象
+func NewRotatedReader(fileName string, backups int) *RotatedReader {
+	return &RotatedReader{name: fileName, backups: backups, locker: NewNullLocker()}
+}
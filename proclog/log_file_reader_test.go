@@ -0,0 +1,155 @@
+package proclog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatedReaderOffsetsSurviveRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 10, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	reader := l.Reader()
+
+	_, _ = l.Write([]byte("line-0001\n")) // 写满后滚动为app.log.1
+	_, _ = l.Write([]byte("line-0002\n")) // 滚动后app.log.1被覆盖，line-0001被删除
+	_, _ = l.Write([]byte("line-0003\n"))
+	if size := reader.Size(); size != 30 {
+		t.Fatalf("日志流末尾的偏移应该为30，得到%d", size)
+	}
+	s, err := reader.ReadLog(20, 10)
+	if err != nil || s != "line-0003\n" {
+		t.Fatalf("偏移20应该是第三行，得到%q, %v", s, err)
+	}
+	s, next, _, err := reader.ReadTailLog(0, 100)
+	if err != nil || s != "line-0003\n" || next != 30 {
+		t.Fatalf("已经删除的偏移应该从现存最旧的内容开始读，得到%q, %d, %v", s, next, err)
+	}
+}
+
+func TestRotatedReaderDoesNotBlockWrites(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 10, 2, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	_, _ = l.Write([]byte("line-0001\n"))
+	_, _ = l.Write([]byte("line-0002\n"))
+
+	lines := make([]string, 0)
+	err := l.Reader().ScanLines(func(line *LogLine) bool {
+		// 扫描过程中写入并触发滚动，写入不应该被阻塞，扫描仍然读取快照中的内容
+		done := make(chan struct{})
+		go func() {
+			_, _ = l.Write([]byte("line-0003\n"))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Errorf("扫描日志时写入被阻塞")
+			return false
+		}
+		lines = append(lines, line.Text)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "line-0001" || lines[1] != "line-0002" {
+		t.Fatalf("应该读取快照中的2行，得到%v", lines)
+	}
+}
+
+func TestRemoveBackupFileKeepsOffsets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 10, 3, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	for _, s := range []string{"line-0001\n", "line-0002\n", "line-0003\n", "line-0004\n"} {
+		_, _ = l.Write([]byte(s))
+	}
+	reader := l.Reader()
+	if s, _ := reader.ReadLog(30, 10); s != "line-0004\n" {
+		t.Fatalf("偏移30应该是第四行，得到%q", s)
+	}
+	if err := l.RemoveBackupFile(name + ".3"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := reader.ReadLog(30, 10); err != nil || s != "line-0004\n" {
+		t.Fatalf("删除最旧的备份文件后偏移不应该变化，得到%q, %v", s, err)
+	}
+	if s, _, _, _ := reader.ReadTailLog(0, 100); s != "line-0003\nline-0004\n" {
+		t.Fatalf("应该从现存最旧的内容开始读，得到%q", s)
+	}
+}
+
+func TestClearCurLogFileKeepsOffsets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 100, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	reader := l.Reader()
+	_, _ = l.Write([]byte("line-0001\nline-0002\n"))
+	if err := l.ClearCurLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("line-0003\n"))
+	// 清除之前已经读到偏移20，之后写入的内容应该从偏移20继续
+	s, next, _, err := reader.ReadTailLog(20, 100)
+	if err != nil || s != "line-0003\n" || next != 30 {
+		t.Fatalf("清除当前日志文件后应该从原来的末尾偏移继续，得到%q, %d, %v", s, next, err)
+	}
+}
+
+func TestExternalRotationKeepsOffsets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 100, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	reader := l.Reader()
+	_, _ = l.Write([]byte("line-0001\n"))
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("line-0002\n"))
+	if s, err := reader.ReadLog(10, 10); err != nil || s != "line-0002\n" {
+		t.Fatalf("外部滚动后偏移10应该是第二行，得到%q, %v", s, err)
+	}
+
+	// 模拟logrotate删除最旧的备份文件并移动当前文件，通过checkFile发现文件被移动
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	l.lastCheck = time.Time{}
+	_, _ = l.Write([]byte("line-0003\n"))
+	s, next, _, err := reader.ReadTailLog(20, 100)
+	if err != nil || s != "line-0003\n" || next != 30 {
+		t.Fatalf("备份文件被外部删除后偏移不应该变化，得到%q, %d, %v", s, next, err)
+	}
+	if s, _ := reader.ReadLog(10, 10); s != "line-0002\n" {
+		t.Fatalf("偏移10应该仍然是第二行，得到%q", s)
+	}
+}
+
+func TestLogBaseFileIsHidden(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	l := NewFileLogger(name, 10, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	_, _ = l.Write([]byte("line-0001\n"))
+	_, _ = l.Write([]byte("line-0002\n"))
+	if _, err := os.Stat(filepath.Join(dir, ".app.log.offset")); err != nil {
+		t.Fatalf("起始偏移应该保存在隐藏文件中：%v", err)
+	}
+	if backups := ListBackupFiles(name); len(backups) != 1 || backups[0] != name+".1" {
+		t.Fatalf("备份文件应该只有%s.1，得到%v", name, backups)
+	}
+	matches, _ := filepath.Glob(name + ".*")
+	for _, m := range matches {
+		if strings.HasSuffix(m, ".offset") {
+			t.Fatalf("偏移文件不应该被name.*匹配到：%v", matches)
+		}
+	}
+}
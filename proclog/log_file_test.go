@@ -0,0 +1,110 @@
+package proclog
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSinkChownsCreatedDirs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("需要root权限修改所属用户")
+	}
+	root := t.TempDir()
+	name := filepath.Join(root, "a", "b", "app.log")
+	u, _ := url.Parse("file://" + name)
+	l, err := newFileSink("app", u, NewNullLocker(), 1024, 1, map[string]string{
+		"file_uid": "65534", "file_gid": "65534", "dir_mode": "0750",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	for _, p := range []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b"), name} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); stat.Uid != 65534 || stat.Gid != 65534 {
+			t.Fatalf("[%s]的所属用户应该为65534，得到%d:%d", p, stat.Uid, stat.Gid)
+		}
+	}
+	if info, _ := os.Stat(root); info.Sys().(*syscall.Stat_t).Uid == 65534 {
+		t.Fatalf("已经存在的目录[%s]不应该被修改", root)
+	}
+}
+
+// 像logrotate(create模式)一样移动日志文件
+func rotateAway(t *testing.T, name string) os.FileInfo {
+	moved, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	return moved
+}
+
+func TestFileLoggerReopen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 1024, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	_, _ = l.Write([]byte("before\n"))
+	moved := rotateAway(t, name)
+
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("after\n"))
+	current, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("Reopen之后应该创建新的日志文件：%v", err)
+	}
+	if os.SameFile(moved, current) {
+		t.Fatalf("Reopen之后应该写入新的文件")
+	}
+	if b, _ := os.ReadFile(name); string(b) != "after\n" {
+		t.Fatalf("新的日志文件内容应该为after，得到%q", b)
+	}
+	if b, _ := os.ReadFile(name + ".1"); string(b) != "before\n" {
+		t.Fatalf("移动后的日志文件不应该再写入，得到%q", b)
+	}
+}
+
+func TestFileLoggerDetectsMovedFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFileLogger(name, 1024, 1, NewNullLocker())
+	defer func() { _ = l.Close() }()
+	_, _ = l.Write([]byte("before\n"))
+	moved := rotateAway(t, name)
+
+	// 检查间隔之内继续写入移动后的文件
+	_, _ = l.Write([]byte("pending\n"))
+	if b, _ := os.ReadFile(name + ".1"); string(b) != "before\npending\n" {
+		t.Fatalf("检查间隔之内应该继续写入原来的文件，得到%q", b)
+	}
+	l.lastCheck = time.Now().Add(-fileCheckInterval)
+	_, _ = l.Write([]byte("after\n"))
+	current, err := os.Stat(name)
+	if err != nil || os.SameFile(moved, current) {
+		t.Fatalf("发现文件被移动后应该重新打开新的文件：%v", err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "after\n" {
+		t.Fatalf("新的日志文件内容应该为after，得到%q", b)
+	}
+
+	// 文件被删除时同样重新创建
+	if err = os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	l.lastCheck = time.Now().Add(-fileCheckInterval)
+	_, _ = l.Write([]byte("recreated\n"))
+	if b, _ := os.ReadFile(name); string(b) != "recreated\n" {
+		t.Fatalf("文件被删除后应该重新创建，得到%q", b)
+	}
+}
@@ -0,0 +1,237 @@
+package proclog
+
+import (
+	"sync"
+	"time"
+)
+
+// Filter 日志过滤器，在日志写入任何输出(文件、syslog、channel等)之前对内容进行处理
+// 返回处理后的内容，返回空内容表示丢弃本次写入
+type Filter interface {
+	Filter(p []byte) []byte
+}
+
+// FilterFunc 函数形式的过滤器
+type FilterFunc func(p []byte) []byte
+
+func (f FilterFunc) Filter(p []byte) []byte {
+	return f(p)
+}
+
+/*
+Flusher 会缓存部分内容的过滤器(如按行处理时还没有换行符的内容)，
+FilterLogger每隔flushInterval以及关闭时调用Flush，返回的内容交给之后的过滤器继续处理
+*/
+type Flusher interface {
+	// Flush 返回需要输出的缓存内容，final为true表示日志即将关闭，需要返回所有缓存的内容
+	Flush(final bool) []byte
+}
+
+// 定时调用Flusher的间隔
+const flushInterval = time.Second
+
+/*
+过滤日志类型，依次执行过滤器链后，再写入内部的日志对象
+*/
+type FilterLogger struct {
+	lock    sync.Mutex
+	filters []Filter
+	logger  Logger
+	pid     int
+	stop    chan struct{} // 有Flusher时定时flush，关闭时停止
+	closed  bool
+}
+
+func (that *FilterLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	if err := that.write(p, that.filters); err != nil {
+		return 0, err
+	}
+	// 过滤器可能改变内容长度，对写入方来说，原始内容已经全部处理完毕
+	return len(p), nil
+}
+
+// 依次执行过滤器后写入内部的日志对象，调用方需要持有锁
+func (that *FilterLogger) write(b []byte, filters []Filter) error {
+	for _, f := range filters {
+		if len(b) == 0 {
+			break
+		}
+		b = f.Filter(b)
+	}
+	if len(b) > 0 {
+		if _, err := that.logger.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 输出Flusher缓存的内容，调用方需要持有锁
+func (that *FilterLogger) flush(final bool) {
+	for i, f := range that.filters {
+		if flusher, ok := f.(Flusher); ok {
+			if b := flusher.Flush(final); len(b) > 0 {
+				_ = that.write(b, that.filters[i+1:])
+			}
+		}
+	}
+}
+
+// 过滤器链中有Flusher时，启动定时flush，调用方需要持有锁
+func (that *FilterLogger) startFlush() {
+	if that.stop != nil || that.closed {
+		return
+	}
+	found := false
+	for _, f := range that.filters {
+		if _, ok := f.(Flusher); ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+	stop := make(chan struct{})
+	that.stop = stop
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			that.lock.Lock()
+			if !that.closed {
+				that.flush(false)
+			}
+			that.lock.Unlock()
+		}
+	}()
+}
+
+// Close 输出过滤器缓存的内容后关闭内部的日志对象
+func (that *FilterLogger) Close() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if !that.closed {
+		that.closed = true
+		that.flush(true)
+		if that.stop != nil {
+			close(that.stop)
+		}
+	}
+	return that.logger.Close()
+}
+
+func (that *FilterLogger) SetPid(pid int) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	that.pid = pid
+	that.logger.SetPid(pid)
+}
+
+// 获取当前的内部日志对象
+func (that *FilterLogger) current() Logger {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.logger
+}
+
+func (that *FilterLogger) ReadLog(offset int64, length int64) (string, error) {
+	return that.current().ReadLog(offset, length)
+}
+
+func (that *FilterLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
+	return that.current().ReadTailLog(offset, length)
+}
+
+func (that *FilterLogger) ClearCurLogFile() error {
+	return that.current().ClearCurLogFile()
+}
+
+func (that *FilterLogger) ClearAllLogFile() error {
+	return that.current().ClearAllLogFile()
+}
+
+// Loggers 获取内部的日志对象
+func (that *FilterLogger) Loggers() []Logger {
+	return []Logger{that.current()}
+}
+
+/*
+SetLogger 替换内部的日志对象，返回被替换的日志对象，由调用方负责关闭。
+替换与写入使用同一把锁，替换之前的写入全部进入旧的日志对象，之后的写入全部进入新的日志对象，
+不会丢失也不会重复
+*/
+func (that *FilterLogger) SetLogger(logger Logger) Logger {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if that.pid > 0 {
+		logger.SetPid(that.pid)
+	}
+	old := that.logger
+	that.logger = logger
+	return old
+}
+
+// AddLogger 添加一个日志输出，内部的日志对象不是CompositeLogger时，会先包装为CompositeLogger
+func (that *FilterLogger) AddLogger(logger Logger) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if that.pid > 0 {
+		logger.SetPid(that.pid)
+	}
+	if composite, ok := that.logger.(*CompositeLogger); ok {
+		composite.AddLogger(logger)
+		return
+	}
+	that.logger = NewCompositeLogger([]Logger{that.logger, logger})
+}
+
+// RemoveLogger 移除一个日志输出，返回是否找到，被移除的日志对象由调用方负责关闭
+func (that *FilterLogger) RemoveLogger(logger Logger) bool {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if that.logger == logger {
+		that.logger = NewNullLogger()
+		return true
+	}
+	return removeLogger(that.logger, logger)
+}
+
+// 从CompositeLogger及其包含的CompositeLogger中移除日志对象
+func removeLogger(container Logger, logger Logger) bool {
+	composite, ok := container.(*CompositeLogger)
+	if !ok {
+		return false
+	}
+	if composite.RemoveLogger(logger) {
+		return true
+	}
+	for _, l := range composite.Loggers() {
+		if removeLogger(l, logger) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFilter 在过滤器链的末尾添加过滤器
+func (that *FilterLogger) AddFilter(f Filter) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	that.filters = append(that.filters, f)
+	that.startFlush()
+}
+
+func NewFilterLogger(logger Logger, filters ...Filter) *FilterLogger {
+	l := &FilterLogger{logger: logger, filters: filters}
+	l.startFlush()
+	return l
+}
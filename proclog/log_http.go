@@ -0,0 +1,449 @@
+package proclog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// HTTP日志的格式
+const (
+	HTTPFormatNDJSON        = "ndjson"        // 每行一个json记录
+	HTTPFormatLoki          = "loki"          // Loki的push接口: /loki/api/v1/push
+	HTTPFormatElasticsearch = "elasticsearch" // Elasticsearch的bulk接口: /_bulk
+)
+
+// 关闭时发送剩余日志的最长时间，超时后未发送的日志被丢弃
+var httpCloseTimeout = 5 * time.Second
+
+// HTTP日志自身使用的URL参数，发送请求时会从URL中去掉
+var httpSinkOptions = []string{"format", "batch_size", "flush_interval", "gzip", "header", "max_retries", "timeout", "index", "queue_size"}
+
+func init() {
+	RegisterSink("http", newHTTPSink)
+	RegisterSink("https", newHTTPSink)
+}
+
+// http(s)://host/path?format=loki&batch_size=500&flush_interval=2s&gzip=true&header=Authorization:Bearer%20xxx
+func newHTTPSink(programName string, u *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+	query := u.Query()
+	config := &HTTPConfig{
+		Format:     props["format"],
+		BatchSize:  propInt(props, "batch_size", 100),
+		MaxRetries: propInt(props, "max_retries", 5),
+		Gzip:       propBool(props, "gzip", false),
+		Index:      props["index"],
+		QueueSize:  propInt(props, "queue_size", 4096),
+		Headers:    make(map[string]string),
+	}
+	if value, ok := props["flush_interval"]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "flush_interval[%s]不合法", value)
+		}
+		config.FlushInterval = d
+	}
+	if value, ok := props["timeout"]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "timeout[%s]不合法", value)
+		}
+		config.Timeout = d
+	}
+	for _, h := range query["header"] {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return nil, gerror.Newf("header[%s]的格式应该为Key:Value", h)
+		}
+		config.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	for _, key := range httpSinkOptions {
+		query.Del(key)
+	}
+	target := *u
+	target.RawQuery = query.Encode()
+	config.URL = target.String()
+	return NewHTTPLogger(programName, props["stream"], config)
+}
+
+// HTTPConfig HTTP日志的配置
+type HTTPConfig struct {
+	URL           string            // 接收日志的地址
+	Format        string            // 日志格式，可选值：[ndjson,loki,elasticsearch]，默认ndjson
+	BatchSize     int               // 每批最多的记录数，默认100
+	FlushInterval time.Duration     // 最长的发送间隔，默认1秒
+	MaxRetries    int               // 发送失败后的最大重试次数，默认5
+	Timeout       time.Duration     // 每次请求的超时时间，默认10秒
+	Gzip          bool              // 是否使用gzip压缩请求内容
+	Headers       map[string]string // 请求头，如Authorization
+	Index         string            // Elasticsearch的索引名称，默认为进程名称
+	QueueSize     int               // 等待发送的记录队列长度，队列已满时丢弃，默认4096
+}
+
+// HTTPRecord 一条日志记录
+type HTTPRecord struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Name    string    `json:"name"`
+	Stream  string    `json:"stream,omitempty"`
+	Pid     int       `json:"pid,omitempty"`
+	Message string    `json:"message"`
+}
+
+/*
+HTTPLogger 把日志按批次POST到HTTP接口，按记录数和时间间隔发送，失败时按指数退避重试
+*/
+type HTTPLogger struct {
+	NullLogger
+	config   *HTTPConfig
+	client   *http.Client
+	name     string
+	stream   string
+	hostname string
+	pid      int32
+
+	lock   sync.Mutex
+	lines  lineBuffer // 按行拆分写入的内容
+	closed bool
+
+	records chan *HTTPRecord
+	done    chan struct{}
+	ctx     context.Context // 关闭超时后取消，中止正在进行的请求和重试
+	cancel  context.CancelFunc
+	pending int64 // 等待发送的记录数
+	dropped int64 // 丢弃的记录数
+	healthy int32 // 最后一次发送是否成功
+}
+
+func (that *HTTPLogger) SetPid(pid int) {
+	atomic.StoreInt32(&that.pid, int32(pid))
+}
+
+// 加入一条记录，队列已满时丢弃
+func (that *HTTPLogger) push(line []byte) {
+	record := &HTTPRecord{
+		Time:    time.Now(),
+		Host:    that.hostname,
+		Name:    that.name,
+		Stream:  that.stream,
+		Pid:     int(atomic.LoadInt32(&that.pid)),
+		Message: string(line),
+	}
+	select {
+	case that.records <- record:
+		atomic.AddInt64(&that.pending, 1)
+	default:
+		atomic.AddInt64(&that.dropped, 1)
+	}
+}
+
+func (that *HTTPLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if that.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	for _, line := range that.lines.split(p) {
+		that.push(trimLine(line))
+	}
+	return len(p), nil
+}
+
+// Close 发送剩余的日志后关闭，最多等待httpCloseTimeout
+func (that *HTTPLogger) Close() error {
+	that.lock.Lock()
+	if !that.closed {
+		that.closed = true
+		if line := that.lines.flush(true); line != nil {
+			that.push(line)
+		}
+		close(that.records)
+		timer := time.AfterFunc(httpCloseTimeout, that.cancel)
+		go func() {
+			<-that.done
+			timer.Stop()
+			that.cancel()
+		}()
+	}
+	that.lock.Unlock()
+	<-that.done
+	return nil
+}
+
+// SpoolStats 获取发送状态，Records为等待发送的记录数
+func (that *HTTPLogger) SpoolStats() SpoolStats {
+	return SpoolStats{
+		Connected: atomic.LoadInt32(&that.healthy) == 1,
+		Records:   atomic.LoadInt64(&that.pending),
+		Dropped:   atomic.LoadInt64(&that.dropped),
+	}
+}
+
+// 按格式生成请求内容
+func (that *HTTPLogger) encode(batch []*HTTPRecord) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch that.config.Format {
+	case HTTPFormatLoki:
+		values := make([][2]string, 0, len(batch))
+		for _, r := range batch {
+			values = append(values, [2]string{strconv.FormatInt(r.Time.UnixNano(), 10), r.Message})
+		}
+		labels := map[string]string{"job": that.name, "host": that.hostname}
+		if len(that.stream) > 0 {
+			labels["stream"] = that.stream
+		}
+		body := map[string]interface{}{
+			"streams": []map[string]interface{}{{"stream": labels, "values": values}},
+		}
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/json", nil
+	case HTTPFormatElasticsearch:
+		index := that.config.Index
+		if len(index) == 0 {
+			index = that.name
+		}
+		action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": index}})
+		encoder := json.NewEncoder(&buf)
+		for _, r := range batch {
+			buf.Write(action)
+			buf.WriteByte('\n')
+			if err := encoder.Encode(r); err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	default:
+		encoder := json.NewEncoder(&buf)
+		for _, r := range batch {
+			if err := encoder.Encode(r); err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	}
+}
+
+// 发送一次请求，返回是否可以重试
+func (that *HTTPLogger) post(body []byte, contentType string) (bool, error) {
+	var reader io.Reader = bytes.NewReader(body)
+	if that.config.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		reader = &buf
+	}
+	req, err := http.NewRequestWithContext(that.ctx, http.MethodPost, that.config.URL, reader)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if that.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range that.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := that.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("http status %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// 丢弃一批记录
+func (that *HTTPLogger) drop(batch []*HTTPRecord) {
+	atomic.AddInt64(&that.dropped, int64(len(batch)))
+	atomic.AddInt64(&that.pending, -int64(len(batch)))
+}
+
+// 发送一批记录，attempt为已经重试的次数，返回是否需要稍后重试，不需要重试时记录已经发送或者丢弃
+func (that *HTTPLogger) send(batch []*HTTPRecord, attempt int) bool {
+	body, contentType, err := that.encode(batch)
+	if err != nil {
+		that.drop(batch)
+		return false
+	}
+	retry, err := that.post(body, contentType)
+	if err == nil {
+		atomic.StoreInt32(&that.healthy, 1)
+		atomic.AddInt64(&that.pending, -int64(len(batch)))
+		return false
+	}
+	atomic.StoreInt32(&that.healthy, 0)
+	if !retry || attempt >= that.config.MaxRetries {
+		fmt.Printf("Fail to ship %d log records to %s with error %v\n", len(batch), that.config.URL, err)
+		that.drop(batch)
+		return false
+	}
+	return true
+}
+
+// 关闭时阻塞发送剩余的记录，失败时按指数退避重试，直到超过重试次数或者关闭超时
+func (that *HTTPLogger) flush(batch []*HTTPRecord, attempt int, backoff time.Duration) {
+	for len(batch) > 0 && that.send(batch, attempt) {
+		select {
+		case <-time.After(backoff):
+		case <-that.ctx.Done():
+			fmt.Printf("Fail to ship %d log records to %s before close\n", len(batch), that.config.URL)
+			that.drop(batch)
+			return
+		}
+		attempt++
+		if backoff *= 2; backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// 定时把缓存超过partialLineAge的不完整行加入队列，如没有换行符的提示符
+func (that *HTTPLogger) flushPartial() {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if that.closed {
+		return
+	}
+	if line := that.lines.flush(false); line != nil {
+		that.push(line)
+	}
+}
+
+/*
+按记录数和时间间隔发送日志。发送失败时不阻塞队列的消费：失败的一批等待退避时间后再重试，
+期间继续从队列中接收新的记录，等待重试和等待发送的记录最多QueueSize条，之后的记录留在队列中
+*/
+func (that *HTTPLogger) start() {
+	go func() {
+		defer close(that.done)
+		ticker := time.NewTicker(that.config.FlushInterval)
+		defer ticker.Stop()
+		batch := make([]*HTTPRecord, 0, that.config.BatchSize)
+		var failed []*HTTPRecord // 等待重试的一批记录
+		var retryC <-chan time.Time
+		attempt, backoff := 0, reconnectMinBackoff
+		ship := func(b []*HTTPRecord) {
+			if len(b) > 0 && that.send(b, attempt) {
+				failed, retryC = b, time.After(backoff)
+				attempt++
+				if backoff *= 2; backoff > reconnectMaxBackoff {
+					backoff = reconnectMaxBackoff
+				}
+				return
+			}
+			failed, retryC = nil, nil
+			attempt, backoff = 0, reconnectMinBackoff
+		}
+		// 没有等待重试的记录时，按BatchSize分批发送
+		drain := func() {
+			for failed == nil && len(batch) > 0 {
+				n := len(batch)
+				if n > that.config.BatchSize {
+					n = that.config.BatchSize
+				}
+				ship(batch[:n:n])
+				batch = batch[n:]
+			}
+		}
+		for {
+			// 等待重试和等待发送的记录已满时暂停接收，新的记录留在队列中，队列也满时由push丢弃
+			records := that.records
+			if failed != nil && len(failed)+len(batch) >= that.config.QueueSize {
+				records = nil
+			}
+			select {
+			case r, ok := <-records:
+				if !ok {
+					that.flush(failed, attempt, backoff)
+					for len(batch) > 0 {
+						n := len(batch)
+						if n > that.config.BatchSize {
+							n = that.config.BatchSize
+						}
+						that.flush(batch[:n], 0, reconnectMinBackoff)
+						batch = batch[n:]
+					}
+					return
+				}
+				batch = append(batch, r)
+				if len(batch) >= that.config.BatchSize {
+					drain()
+				}
+			case <-retryC:
+				ship(failed)
+			case <-that.ctx.Done():
+				// 关闭超时，丢弃所有没有发送的记录
+				fmt.Printf("Fail to ship %d log records to %s before close\n", atomic.LoadInt64(&that.pending), that.config.URL)
+				that.drop(failed)
+				that.drop(batch)
+				for r := range that.records {
+					that.drop([]*HTTPRecord{r})
+				}
+				return
+			case <-ticker.C:
+				that.flushPartial()
+				drain()
+			}
+		}
+	}()
+}
+
+// NewHTTPLogger 创建HTTP日志对象，name为进程名称，stream为日志流名称
+func NewHTTPLogger(name string, stream string, config *HTTPConfig) (*HTTPLogger, error) {
+	if _, err := url.Parse(config.URL); err != nil {
+		return nil, err
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 4096
+	}
+	switch config.Format {
+	case "", "json", "jsonl":
+		config.Format = HTTPFormatNDJSON
+	case HTTPFormatNDJSON, HTTPFormatLoki, HTTPFormatElasticsearch:
+	default:
+		return nil, gerror.Newf("不支持的HTTP日志格式[%s]", config.Format)
+	}
+	logger := &HTTPLogger{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		name:    name,
+		stream:  stream,
+		records: make(chan *HTTPRecord, config.QueueSize),
+		done:    make(chan struct{}),
+		healthy: 1,
+	}
+	logger.ctx, logger.cancel = context.WithCancel(context.Background())
+	logger.hostname, _ = os.Hostname()
+	logger.start()
+	return logger, nil
+}
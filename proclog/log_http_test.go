@@ -0,0 +1,229 @@
+package proclog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPLoggerNDJSON(t *testing.T) {
+	var lock sync.Mutex
+	messages := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("format") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var record HTTPRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+				lock.Lock()
+				messages = append(messages, record.Name+":"+record.Stream+":"+record.Message)
+				lock.Unlock()
+			}
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/ingest?format=ndjson&batch_size=2&header=Authorization:Bearer%20token")
+	l, err := newHTTPSink("app", u, nil, 0, 0, map[string]string{"stream": "stdout", "format": "ndjson", "batch_size": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("one\ntwo\nthree"))
+	_ = l.Close()
+
+	lock.Lock()
+	defer lock.Unlock()
+	want := []string{"app:stdout:one", "app:stdout:two", "app:stdout:three"}
+	if len(messages) != len(want) {
+		t.Fatalf("期望收到%v，得到%v", want, messages)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Fatalf("期望收到%v，得到%v", want, messages)
+		}
+	}
+	if _, err = l.Write([]byte("late\n")); err != io.ErrClosedPipe {
+		t.Fatalf("关闭之后写入应该返回io.ErrClosedPipe，得到%v", err)
+	}
+}
+
+func TestHTTPLoggerRetry(t *testing.T) {
+	var lock sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	l, err := NewHTTPLogger("app", "stdout", &HTTPConfig{URL: server.URL, Format: HTTPFormatLoki, MaxRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("retry me\n"))
+	_ = l.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	if calls != 2 || l.SpoolStats().Dropped != 0 {
+		t.Fatalf("返回503后应该重试一次，请求次数%d，丢弃%d", calls, l.SpoolStats().Dropped)
+	}
+}
+
+func TestHTTPLoggerCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := httpCloseTimeout
+	httpCloseTimeout = 200 * time.Millisecond
+	defer func() { httpCloseTimeout = timeout }()
+
+	l, err := NewHTTPLogger("app", "stdout", &HTTPConfig{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("stuck\n"))
+	start := time.Now()
+	_ = l.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("远程服务没有响应时，关闭应该在超时后返回，用时%v", elapsed)
+	}
+	if l.SpoolStats().Dropped != 1 {
+		t.Fatalf("超时没有发送的记录应该被丢弃，丢弃%d", l.SpoolStats().Dropped)
+	}
+}
+
+// 接收ndjson记录的测试服务，fail返回true时请求失败
+func newRecordServer(t *testing.T, fail func() bool) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	messages := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			var record HTTPRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+				lock.Lock()
+				messages = append(messages, record.Message)
+				lock.Unlock()
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), messages...)
+	}
+}
+
+func TestHTTPLoggerGzip(t *testing.T) {
+	var encoding atomic.Value
+	server, messages := newRecordServer(t, func() bool { return false })
+	gzipServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding.Store(r.Header.Get("Content-Encoding"))
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer gzipServer.Close()
+
+	u, _ := url.Parse(gzipServer.URL + "/ingest?gzip=true")
+	l, err := newHTTPSink("app", u, nil, 0, 0, map[string]string{"gzip": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("compressed\n"))
+	_ = l.Close()
+	if encoding.Load() != "gzip" {
+		t.Fatalf("开启gzip时应该设置Content-Encoding，得到%v", encoding.Load())
+	}
+	if got := messages(); len(got) != 1 || got[0] != "compressed" {
+		t.Fatalf("服务端解压后应该得到原始记录，得到%v", got)
+	}
+}
+
+func TestHTTPLoggerFlushesPartialLine(t *testing.T) {
+	age := partialLineAge
+	partialLineAge = 10 * time.Millisecond
+	defer func() { partialLineAge = age }()
+
+	server, messages := newRecordServer(t, nil)
+	l, err := NewHTTPLogger("app", "stdout", &HTTPConfig{URL: server.URL, FlushInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	// 没有换行符的提示符不需要等到关闭，按发送间隔发送
+	_, _ = l.Write([]byte("prompt> "))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("不完整的行应该按发送间隔发送")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := messages(); got[0] != "prompt> " {
+		t.Fatalf("应该发送不完整的行，得到%v", got)
+	}
+}
+
+func TestHTTPLoggerRetryDoesNotBlockQueue(t *testing.T) {
+	var failing int32 = 1
+	server, messages := newRecordServer(t, func() bool { return atomic.LoadInt32(&failing) == 1 })
+	l, err := NewHTTPLogger("app", "stdout", &HTTPConfig{
+		URL:           server.URL,
+		BatchSize:     1,
+		QueueSize:     8,
+		MaxRetries:    100,
+		FlushInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一批重试期间写入超过队列长度的记录，重试不应该阻塞队列的消费
+	want := make([]string, 0)
+	for i := 0; i < 12; i++ {
+		line := fmt.Sprintf("line-%02d", i)
+		want = append(want, line)
+		_, _ = l.Write([]byte(line + "\n"))
+		time.Sleep(5 * time.Millisecond)
+	}
+	atomic.StoreInt32(&failing, 0)
+	_ = l.Close()
+	if dropped := l.SpoolStats().Dropped; dropped != 0 {
+		t.Fatalf("重试期间不应该丢弃记录，丢弃%d", dropped)
+	}
+	if got := messages(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("重试后应该按顺序发送所有记录，得到%v", got)
+	}
+}
@@ -0,0 +1,209 @@
+//go:build linux
+// +build linux
+
+package proclog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/syslog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// 本机journald接收原生协议日志的socket
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+func init() {
+	RegisterSink("journald", newJournalSink)
+}
+
+// journald:// 或者 journald:///path/to/socket?identifier=name&priority=info
+func newJournalSink(programName string, u *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+	socket := u.Path
+	if len(socket) == 0 {
+		socket = defaultJournalSocket
+	}
+	identifier := programName
+	if value, ok := props["identifier"]; ok {
+		identifier = value
+	}
+	stream := props["stream"]
+	// 默认标准输出为info，标准错误为err，方便通过journalctl -p过滤
+	priority := syslog.LOG_INFO
+	if stream == "stderr" {
+		priority = syslog.LOG_ERR
+	}
+	if value, ok := props["priority"]; ok {
+		priority = ToSyslogLevel(value)
+	}
+	return NewJournalLogger(socket, identifier, stream, priority)
+}
+
+/*
+JournalLogger 通过journald的原生协议写入systemd journal，每一行日志为一条记录，
+记录中包含SYSLOG_IDENTIFIER、SYSLOG_PID、PRIORITY、STREAM字段。
+journald会忽略客户端写入的以下划线开头的可信字段(如_PID)，并把它们设置为发送方(即管理进程)的值，
+所以子进程的pid写入SYSLOG_PID，journalctl可以通过SYSLOG_PID=xxx过滤
+*/
+type JournalLogger struct {
+	NullLogger
+	lock       sync.Mutex
+	socket     string
+	conn       *net.UnixConn
+	identifier string
+	stream     string
+	priority   syslog.Priority
+	pid        int32
+	lines      lineBuffer    // 按行拆分写入的内容
+	stop       chan struct{} // 关闭时停止定时输出不完整的行
+	closed     bool
+}
+
+func (that *JournalLogger) SetPid(pid int) {
+	atomic.StoreInt32(&that.pid, int32(pid))
+}
+
+// 写入一个字段，值中包含换行符时使用二进制格式
+func appendJournalField(buf *bytes.Buffer, key string, value []byte) {
+	buf.WriteString(key)
+	if bytes.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.Write(value)
+	} else {
+		buf.WriteByte('\n')
+		_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+		buf.Write(value)
+	}
+	buf.WriteByte('\n')
+}
+
+// 序列化一条日志记录
+func (that *JournalLogger) entry(msg []byte) []byte {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", msg)
+	appendJournalField(&buf, "PRIORITY", []byte(strconv.Itoa(int(that.priority&0x07))))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", []byte(that.identifier))
+	if pid := atomic.LoadInt32(&that.pid); pid > 0 {
+		appendJournalField(&buf, "SYSLOG_PID", []byte(strconv.Itoa(int(pid))))
+	}
+	if len(that.stream) > 0 {
+		appendJournalField(&buf, "STREAM", []byte(that.stream))
+	}
+	return buf.Bytes()
+}
+
+// 发送一条记录，记录过大时通过临时文件的描述符发送，调用方需要加锁
+func (that *JournalLogger) send(data []byte) error {
+	if that.conn == nil {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: that.socket, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		that.conn = conn
+	}
+	_, err := that.conn.Write(data)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		return that.sendFd(data)
+	}
+	_ = that.conn.Close()
+	that.conn = nil
+	return err
+}
+
+// 把记录写入已删除的临时文件，再通过SCM_RIGHTS把文件描述符发送给journald
+func (that *JournalLogger) sendFd(data []byte) error {
+	file, err := os.CreateTemp("/dev/shm", "journal.")
+	if err != nil {
+		if file, err = os.CreateTemp("", "journal."); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	_ = os.Remove(file.Name())
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	_, _, err = that.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), nil)
+	return err
+}
+
+func (that *JournalLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	for _, line := range that.lines.split(p) {
+		if err := that.send(that.entry(trimLine(line))); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// 每隔flushInterval把缓存超过partialLineAge的不完整行作为一条日志写入，如没有换行符的提示符
+func (that *JournalLogger) flushPartial() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-that.stop:
+			return
+		case <-ticker.C:
+		}
+		that.lock.Lock()
+		if line := that.lines.flush(false); line != nil {
+			_ = that.send(that.entry(line))
+		}
+		that.lock.Unlock()
+	}
+}
+
+// Close 写入剩余的不完整行，并关闭连接
+func (that *JournalLogger) Close() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	var err error
+	if !that.closed {
+		that.closed = true
+		close(that.stop)
+		if line := that.lines.flush(true); len(strings.TrimSpace(string(line))) > 0 {
+			err = that.send(that.entry(line))
+		}
+	}
+	if that.conn != nil {
+		_ = that.conn.Close()
+		that.conn = nil
+	}
+	return err
+}
+
+// NewJournalLogger 创建journald日志对象，socket为journald的原生协议socket路径
+func NewJournalLogger(socket string, identifier string, stream string, priority syslog.Priority) (*JournalLogger, error) {
+	logger := &JournalLogger{
+		socket:     socket,
+		identifier: identifier,
+		stream:     stream,
+		priority:   priority,
+		stop:       make(chan struct{}),
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	logger.conn = conn
+	go logger.flushPartial()
+	return logger, nil
+}
@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+package proclog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/syslog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 解析一条journald原生协议的记录
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("记录格式不合法：%q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data[i+1:], '\n')
+			fields[key] = string(data[i+1 : i+1+end])
+			data = data[i+1+end+1:]
+			continue
+		}
+		n := int(binary.LittleEndian.Uint64(data[i+1 : i+9]))
+		fields[key] = string(data[i+9 : i+9+n])
+		data = data[i+9+n+1:]
+	}
+	return fields
+}
+
+func TestJournalLogger(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+	_ = server.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	l, err := NewJournalLogger(socket, "app", "stderr", syslog.LOG_ERR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetPid(42)
+	if _, err = l.Write([]byte("first\nsecond")); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	for _, want := range []string{"first", "second"} {
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatalf("没有收到记录[%s]：%v", want, err)
+		}
+		fields := parseJournalEntry(t, buf[:n])
+		if fields["MESSAGE"] != want || fields["PRIORITY"] != "3" || fields["SYSLOG_IDENTIFIER"] != "app" ||
+			fields["SYSLOG_PID"] != "42" || fields["STREAM"] != "stderr" {
+			t.Fatalf("记录的字段不正确：%v", fields)
+		}
+	}
+}
+
+func TestJournalBinaryField(t *testing.T) {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", []byte("a\nb"))
+	if fields := parseJournalEntry(t, buf.Bytes()); fields["MESSAGE"] != "a\nb" {
+		t.Fatalf("包含换行符的字段应该使用二进制格式：%q", buf.Bytes())
+	}
+}
+
+func TestJournalLoggerFlushesPartialLine(t *testing.T) {
+	age := partialLineAge
+	partialLineAge = 10 * time.Millisecond
+	defer func() { partialLineAge = age }()
+
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+	_ = server.SetReadDeadline(time.Now().Add(3 * flushInterval))
+
+	l, err := NewJournalLogger(socket, "app", "stdout", syslog.LOG_INFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	// 没有换行符的提示符不需要等到关闭，定时写入
+	if _, err = l.Write([]byte("password: ")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65536)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("不完整的行应该定时写入：%v", err)
+	}
+	if fields := parseJournalEntry(t, buf[:n]); fields["MESSAGE"] != "password: " {
+		t.Fatalf("记录的内容不正确：%v", fields)
+	}
+}
@@ -0,0 +1,49 @@
+package proclog
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// NetLogger 把日志原样写入tcp/udp/unix连接，在后台goroutine中写入，连接断开后自动重连
+// 连接不可用期间的日志暂存到磁盘队列中，没有设置磁盘队列时丢弃
+type NetLogger struct {
+	NullLogger
+	*ReliableWriter
+	network string
+	addr    string
+}
+
+func (that *NetLogger) Write(p []byte) (int, error) {
+	return that.ReliableWriter.Write(p)
+}
+
+func (that *NetLogger) Close() error {
+	return that.ReliableWriter.Close()
+}
+
+func (that *NetLogger) dial() (io.WriteCloser, error) {
+	conn, err := net.DialTimeout(that.network, that.addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &deadlineConn{Conn: conn}, nil
+}
+
+// 写入时设置超时的连接
+type deadlineConn struct {
+	net.Conn
+}
+
+func (that *deadlineConn) Write(p []byte) (int, error) {
+	_ = that.Conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return that.Conn.Write(p)
+}
+
+// NewNetLogger 创建网络日志对象，network可选值：[tcp,udp,unix]，spool为nil时不暂存
+func NewNetLogger(network, addr string, spool *DiskSpool) *NetLogger {
+	logger := &NetLogger{network: network, addr: addr}
+	logger.ReliableWriter = NewReliableWriter(logger.dial, spool)
+	return logger
+}
@@ -0,0 +1,149 @@
+package proclog
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// RingLogger 把日志保存在固定大小的内存环形缓冲区中，超出大小后丢弃最旧的内容
+// 偏移量为清空之后写入的总字节数，已经被丢弃的部分不能再读取
+type RingLogger struct {
+	lock    sync.Mutex
+	data    []byte // 固定大小的缓冲区，创建后不再重新分配
+	head    int    // 最旧的内容在data中的位置
+	length  int    // 缓冲区中内容的长度
+	dropped int64  // 已经被丢弃的字节数
+}
+
+func (that *RingLogger) SetPid(_ int) {
+	// NOTHING TO DO
+}
+
+func (that *RingLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	n, size := len(p), len(that.data)
+	// 超过缓冲区大小的部分直接丢弃，只保留最后size个字节
+	if n >= size {
+		that.dropped += int64(that.length + n - size)
+		copy(that.data, p[n-size:])
+		that.head, that.length = 0, size
+		return n, nil
+	}
+	tail := (that.head + that.length) % size
+	copied := copy(that.data[tail:], p)
+	copy(that.data, p[copied:])
+	that.length += n
+	if over := that.length - size; over > 0 {
+		that.dropped += int64(over)
+		that.head = (that.head + over) % size
+		that.length = size
+	}
+	return n, nil
+}
+
+func (that *RingLogger) Close() error {
+	return nil
+}
+
+// 读取[offset, offset+length)范围的内容，调用方需要加锁
+func (that *RingLogger) read(offset int64, length int64) string {
+	if offset < that.dropped {
+		length -= that.dropped - offset
+		offset = that.dropped
+	}
+	if length <= 0 {
+		return ""
+	}
+	buf := make([]byte, length)
+	begin := (that.head + int(offset-that.dropped)) % len(that.data)
+	copied := copy(buf, that.data[begin:])
+	copy(buf[copied:], that.data)
+	return string(buf)
+}
+
+// ReadLog 读取日志，参数的含义与FileLogger.ReadLog相同
+func (that *RingLogger) ReadLog(offset int64, length int64) (string, error) {
+	if offset < 0 && length != 0 {
+		return "", gerror.New("BAD_ARGUMENTS")
+	}
+	if offset >= 0 && length < 0 {
+		return "", gerror.New("BAD_ARGUMENTS")
+	}
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	logLen := that.dropped + int64(that.length)
+	if offset < 0 {
+		offset = logLen + offset
+		if offset < 0 {
+			offset = 0
+		}
+		length = logLen - offset
+	} else if length == 0 {
+		if offset > logLen {
+			return "", nil
+		}
+		length = logLen - offset
+	} else {
+		if offset >= logLen {
+			return "", nil
+		}
+		if offset+length > logLen {
+			length = logLen - offset
+		}
+	}
+	return that.read(offset, length), nil
+}
+
+// ReadTailLog 读取尾部日志，参数和返回值的含义与FileLogger.ReadTailLog相同
+func (that *RingLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
+	if offset < 0 {
+		return "", offset, false, fmt.Errorf("offset should not be less than 0")
+	}
+	if length < 0 {
+		return "", offset, false, fmt.Errorf("length should be not be less than 0")
+	}
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	logLen := that.dropped + int64(that.length)
+	if offset >= logLen {
+		return "", logLen, true, nil
+	}
+	if offset+length > logLen {
+		length = logLen - offset
+	}
+	// 已经被丢弃的部分不能再读取，从缓冲区中最旧的内容开始读
+	if offset < that.dropped {
+		length -= that.dropped - offset
+		offset = that.dropped
+	}
+	s := that.read(offset, length)
+	return s, offset + int64(len(s)), false, nil
+}
+
+// ClearCurLogFile 清空缓冲区
+func (that *RingLogger) ClearCurLogFile() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	that.head, that.length = 0, 0
+	that.dropped = 0
+	return nil
+}
+
+// ClearAllLogFile 清空缓冲区
+func (that *RingLogger) ClearAllLogFile() error {
+	return that.ClearCurLogFile()
+}
+
+// NewRingLogger 创建内存环形缓冲区日志，size为缓冲区的最大字节数
+func NewRingLogger(size int) *RingLogger {
+	if size <= 0 {
+		size = 1024 * 1024
+	}
+	return &RingLogger{data: make([]byte, size)}
+}
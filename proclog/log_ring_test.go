@@ -0,0 +1,79 @@
+package proclog
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRingLoggerWrapAround(t *testing.T) {
+	l := NewRingLogger(10)
+	for _, s := range []string{"abcd", "efgh", "ijkl"} {
+		_, _ = l.Write([]byte(s))
+	}
+	// 写入12个字节，最旧的2个字节被丢弃，内容跨过缓冲区的末尾
+	if s, _ := l.ReadLog(0, 0); s != "cdefghijkl" {
+		t.Fatalf("应该保留最后10个字节，得到%q", s)
+	}
+	if s, _ := l.ReadLog(7, 4); s != "hijk" {
+		t.Fatalf("跨过缓冲区末尾读取，得到%q", s)
+	}
+	if s, _ := l.ReadLog(-3, 0); s != "jkl" {
+		t.Fatalf("读取最后3个字节，得到%q", s)
+	}
+	s, next, overflow, err := l.ReadTailLog(0, 100)
+	if err != nil || s != "cdefghijkl" || next != 12 || overflow {
+		t.Fatalf("已经丢弃的偏移应该从最旧的内容开始读，得到%q, %d, %v, %v", s, next, overflow, err)
+	}
+	if s, next, overflow, _ = l.ReadTailLog(12, 100); s != "" || next != 12 || !overflow {
+		t.Fatalf("读到末尾时应该返回空，得到%q, %d, %v", s, next, overflow)
+	}
+}
+
+func TestRingLoggerCap(t *testing.T) {
+	l := NewRingLogger(8)
+	_, _ = l.Write([]byte("0123456789abcdef"))
+	if s, _ := l.ReadLog(0, 0); s != "89abcdef" {
+		t.Fatalf("超过缓冲区大小的写入只保留最后8个字节，得到%q", s)
+	}
+	for i := 0; i < 1000; i++ {
+		_, _ = l.Write([]byte("xyz"))
+	}
+	if len(l.data) != 8 || cap(l.data) != 8 || l.length != 8 {
+		t.Fatalf("缓冲区大小不应该变化，得到len=%d cap=%d length=%d", len(l.data), cap(l.data), l.length)
+	}
+	if s, _ := l.ReadLog(-8, 0); len(s) != 8 {
+		t.Fatalf("应该能读取8个字节，得到%q", s)
+	}
+	if err := l.ClearCurLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Write([]byte("new"))
+	if s, _ := l.ReadLog(0, 0); s != "new" {
+		t.Fatalf("清空后偏移应该从0开始，得到%q", s)
+	}
+}
+
+func TestRingLoggerReadDuringWrite(t *testing.T) {
+	const line = "0123456789\n"
+	l := NewRingLogger(100)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			_, _ = l.Write([]byte(line))
+		}
+	}()
+	// 每次写入都是完整的一行，读取到的内容按行对齐时应该总是完整的行
+	for i := 0; i < 2000; i++ {
+		s, _ := l.ReadLog(-int64(len(line))*5, 0)
+		if len(s)%len(line) != 0 || strings.Repeat(line, len(s)/len(line)) != s {
+			t.Fatalf("读取时得到了不完整的内容%q", s)
+		}
+	}
+	wg.Wait()
+	if s, _ := l.ReadLog(-100, 0); s[1:] != strings.Repeat(line, 9) {
+		t.Fatalf("写入结束后应该保留最后100个字节，得到%q", s)
+	}
+}
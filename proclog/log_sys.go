@@ -8,8 +8,37 @@ import (
 	"fmt"
 	"io"
 	"log/syslog"
+	"net/url"
+	"sync"
 )
 
+func init() {
+	RegisterSink("syslog", newSysLogSink)
+}
+
+// syslog:// 为本机syslog
+// syslog://host[:port]?protocol=tcp&facility=local0&priority=notice&tag=name 为远程syslog
+// format=rfc5424或者protocol=tls时，使用RFC5424格式，tls的证书配置见NewTLSConfig
+func newSysLogSink(programName string, u *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+	for _, key := range []string{"priority", "facility", "tag"} {
+		if value, ok := props[key]; ok {
+			props["syslog_"+key] = value
+		}
+	}
+	if len(u.Host) == 0 {
+		return NewSysLogger(programName, props), nil
+	}
+	protocol, ok := props["protocol"]
+	config := u.Host
+	if ok {
+		config = protocol + ":" + u.Host
+	}
+	if protocol == "tls" || props["format"] == "rfc5424" {
+		return NewRFC5424Logger(programName, config, props)
+	}
+	return NewRemoteSysLogger(programName, config, props), nil
+}
+
 type SysLogger struct {
 	NullLogger
 	logWriter io.WriteCloser
@@ -29,6 +58,14 @@ func (that *SysLogger) Close() error {
 	return that.logWriter.Close()
 }
 
+// SpoolStats 获取远程syslog的暂存状态
+func (that *SysLogger) SpoolStats() SpoolStats {
+	if reporter, ok := that.logWriter.(SpoolReporter); ok {
+		return reporter.SpoolStats()
+	}
+	return SpoolStats{}
+}
+
 func GetSyslogPriority(props map[string]string) syslog.Priority {
 	logLevel := syslog.LOG_NOTICE
 	if value, ok := props["syslog_priority"]; ok {
@@ -73,12 +110,8 @@ func NewRemoteSysLogger(name string, config string, props map[string]string) *Sy
 		tag = value
 	}
 
-	writer, err := syslog.Dial(protocol, fmt.Sprintf("%s:%d", host, port), priority, tag)
-	logger := &SysLogger{}
-	if writer != nil && err == nil {
-		logger.logWriter = writer
-	} else {
-		logger.logWriter = NewBackendSysLogWriter(protocol, fmt.Sprintf("%s:%d", host, port), priority, name)
-	}
-	return logger
+	// 在后台连接并写入，连接失败或者写入失败时暂存到spool_dir中，恢复后重放
+	raddr := fmt.Sprintf("%s:%d", host, port)
+	spool := NewSpoolFromProps(name, protocol+"://"+raddr, props)
+	return &SysLogger{logWriter: NewBackendSysLogWriter(protocol, raddr, priority, tag, spool)}
 }
@@ -3,55 +3,25 @@
 
 package proclog
 
-import "log/syslog"
+import (
+	"io"
+	"log/syslog"
+)
 
+// BackendSysLogWriter 在后台写入远程syslog，连接失败或者写入失败时暂存到磁盘队列中，恢复后重放
 type BackendSysLogWriter struct {
-	network    string
-	raddr      string
-	priority   syslog.Priority
-	tag        string
-	logChannel chan []byte
+	*ReliableWriter
+	network  string
+	raddr    string
+	priority syslog.Priority
+	tag      string
 }
 
-// Write data to the backend syslog writer
-func (bs *BackendSysLogWriter) Write(b []byte) (int, error) {
-	bs.logChannel <- b
-	return len(b), nil
-}
-
-// Close background write channel
-func (bs *BackendSysLogWriter) Close() error {
-	close(bs.logChannel)
-	return nil
-}
-
-func (bs *BackendSysLogWriter) start() {
-	go func() {
-		var writer *syslog.Writer = nil
-		for {
-			b, ok := <-bs.logChannel
-			// if channel is closed
-			if !ok {
-				if writer != nil {
-					_ = writer.Close()
-				}
-				break
-			}
-			// if not connect to syslog, try to connect to it
-			if writer == nil {
-				writer, _ = syslog.Dial(bs.network, bs.raddr, bs.priority, bs.tag)
-			}
-			if writer != nil {
-				_, _ = writer.Write(b)
-			}
-
-		}
-	}()
-}
-
-// NewBackendSysLogWriter creates background syslog writer
-func NewBackendSysLogWriter(network, raddr string, priority syslog.Priority, tag string) *BackendSysLogWriter {
-	bs := &BackendSysLogWriter{network: network, raddr: raddr, priority: priority, tag: tag, logChannel: make(chan []byte)}
-	bs.start()
+// NewBackendSysLogWriter creates background syslog writer, spool could be nil
+func NewBackendSysLogWriter(network, raddr string, priority syslog.Priority, tag string, spool *DiskSpool) *BackendSysLogWriter {
+	bs := &BackendSysLogWriter{network: network, raddr: raddr, priority: priority, tag: tag}
+	bs.ReliableWriter = NewReliableWriter(func() (io.WriteCloser, error) {
+		return syslog.Dial(bs.network, bs.raddr, bs.priority, bs.tag)
+	}, spool)
 	return bs
 }
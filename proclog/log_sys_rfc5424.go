@@ -0,0 +1,228 @@
+//go:build !windows
+// +build !windows
+
+package proclog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// RFC5424的结构化数据ID，32473为RFC5612中保留用于文档示例的企业编号
+const rfc5424SDID = "proc@32473"
+
+// RFC5424的时间格式，最多6位小数
+const rfc5424TimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+/*
+RFC5424Writer 按RFC5424格式写入syslog，udp每个消息一个数据报，
+tcp和tls使用RFC6587/RFC5425的octet-counting分帧: "MSG-LEN SP SYSLOG-MSG"
+消息在后台写入，远程服务不可用时暂存到磁盘队列中
+*/
+type RFC5424Writer struct {
+	out       *ReliableWriter
+	network   string // udp、tcp、tls
+	raddr     string
+	tlsConfig *tls.Config
+	priority  syslog.Priority
+	hostname  string
+	appName   string
+	msgID     string // 写入MSGID字段，为空时写入"-"
+	name      string // 进程名称，写入结构化数据
+	pid       int32
+}
+
+// SetPid 设置写入PROCID和结构化数据的进程pid
+func (that *RFC5424Writer) SetPid(pid int) {
+	atomic.StoreInt32(&that.pid, int32(pid))
+}
+
+func (that *RFC5424Writer) dial() (io.WriteCloser, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if that.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", that.raddr, that.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(that.network, that.raddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deadlineConn{Conn: conn}, nil
+}
+
+// 转义结构化数据中的参数值
+func escapeSDParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+func nilValue(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+// Format 把一行日志格式化为RFC5424消息
+func (that *RFC5424Writer) Format(msg []byte, t time.Time) []byte {
+	procID := "-"
+	sd := fmt.Sprintf(`[%s name="%s"]`, rfc5424SDID, escapeSDParam(that.name))
+	if pid := atomic.LoadInt32(&that.pid); pid > 0 {
+		procID = strconv.Itoa(int(pid))
+		sd = fmt.Sprintf(`[%s name="%s" pid="%d"]`, rfc5424SDID, escapeSDParam(that.name), pid)
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s %s ",
+		that.priority,
+		t.Format(rfc5424TimeLayout),
+		nilValue(that.hostname),
+		nilValue(that.appName),
+		procID,
+		nilValue(that.msgID),
+		sd)
+	return append([]byte(header), msg...)
+}
+
+// Write 每一行日志作为一条syslog消息写入
+func (that *RFC5424Writer) Write(p []byte) (int, error) {
+	now := time.Now()
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		msg := that.Format(line, now)
+		if that.network != "udp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+		if _, err := that.out.Write(msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (that *RFC5424Writer) Close() error {
+	return that.out.Close()
+}
+
+// SpoolStats 获取暂存状态
+func (that *RFC5424Writer) SpoolStats() SpoolStats {
+	return that.out.SpoolStats()
+}
+
+// NewTLSConfig 根据props创建tls配置：
+//
+//	tls_ca: 校验服务端证书的CA证书文件(PEM)，为空时使用系统CA
+//	tls_cert、tls_key: 客户端证书和私钥文件(PEM)
+//	tls_server_name: 校验的服务端名称，默认为连接的主机名
+//	tls_insecure_skip_verify: 是否跳过服务端证书校验
+func NewTLSConfig(host string, props map[string]string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: propBool(props, "tls_insecure_skip_verify", false),
+	}
+	if name, ok := props["tls_server_name"]; ok {
+		config.ServerName = name
+	}
+	if caFile, ok := props["tls_ca"]; ok {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "读取CA证书[%s]失败", caFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, gerror.Newf("CA证书[%s]中没有有效的证书", caFile)
+		}
+		config.RootCAs = pool
+	}
+	certFile, hasCert := props["tls_cert"]
+	keyFile, hasKey := props["tls_key"]
+	if hasCert || hasKey {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, gerror.Wrap(err, "加载客户端证书失败")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// NewRFC5424Writer 创建RFC5424格式的syslog写入对象，protocol可选值：[udp,tcp,tls]
+func NewRFC5424Writer(name, protocol, raddr string, props map[string]string) (*RFC5424Writer, error) {
+	writer := &RFC5424Writer{
+		network:  protocol,
+		raddr:    raddr,
+		priority: GetSyslogPriority(props),
+		appName:  name,
+		msgID:    props["stream"],
+		name:     name,
+	}
+	if value, ok := props["syslog_tag"]; ok {
+		writer.appName = value
+	}
+	writer.hostname, _ = os.Hostname()
+	switch protocol {
+	case "udp", "tcp":
+	case "tls":
+		host, _, err := net.SplitHostPort(raddr)
+		if err != nil {
+			return nil, err
+		}
+		if writer.tlsConfig, err = NewTLSConfig(host, props); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, gerror.Newf("不支持的syslog协议[%s]", protocol)
+	}
+	writer.out = NewReliableWriter(writer.dial, NewSpoolFromProps(name, protocol+"://"+raddr, props))
+	return writer, nil
+}
+
+// RFC5424Logger RFC5424格式的远程syslog日志
+type RFC5424Logger struct {
+	NullLogger
+	writer *RFC5424Writer
+}
+
+func (that *RFC5424Logger) Write(p []byte) (int, error) {
+	return that.writer.Write(p)
+}
+
+func (that *RFC5424Logger) Close() error {
+	return that.writer.Close()
+}
+
+func (that *RFC5424Logger) SetPid(pid int) {
+	that.writer.SetPid(pid)
+}
+
+// SpoolStats 获取暂存状态
+func (that *RFC5424Logger) SpoolStats() SpoolStats {
+	return that.writer.SpoolStats()
+}
+
+// NewRFC5424Logger 创建RFC5424格式的远程syslog日志对象，config的格式与ParseSysLogConfig相同
+func NewRFC5424Logger(name string, config string, props map[string]string) (*RFC5424Logger, error) {
+	protocol, host, port, err := ParseSysLogConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewRFC5424Writer(name, protocol, net.JoinHostPort(host, strconv.Itoa(port)), props)
+	if err != nil {
+		return nil, err
+	}
+	return &RFC5424Logger{writer: writer}, nil
+}
@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package proclog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 读取一条octet-counting分帧的消息
+func readFrame(r *bufio.Reader) (string, error) {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	if _, err = io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+// 接受一个连接，读取count条消息，出错时返回已经读到的消息
+func acceptFrames(ln net.Listener, count int) <-chan []string {
+	ch := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			ch <- nil
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		msgs := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			msg, err := readFrame(r)
+			if err != nil {
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+		ch <- msgs
+	}()
+	return ch
+}
+
+func checkRFC5424(t *testing.T, msg string, text string) {
+	t.Helper()
+	if !strings.HasPrefix(msg, "<") || !strings.Contains(msg, ">1 ") {
+		t.Fatalf("消息头不是RFC5424格式：%q", msg)
+	}
+	if !strings.Contains(msg, ` app 42 - [proc@32473 name="app" pid="42"] `) {
+		t.Fatalf("消息中没有APP-NAME、PROCID和结构化数据：%q", msg)
+	}
+	if !strings.HasSuffix(msg, " "+text) {
+		t.Fatalf("消息内容应该为%q：%q", text, msg)
+	}
+}
+
+func TestRFC5424WriterTCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	frames := acceptFrames(ln, 2)
+
+	writer, err := NewRFC5424Writer("app", "tcp", ln.Addr().String(), map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.SetPid(42)
+	_, _ = writer.Write([]byte("first line\nsecond line\n"))
+	msgs := <-frames
+	_ = writer.Close()
+	if len(msgs) != 2 {
+		t.Fatalf("应该收到2条消息，得到%v", msgs)
+	}
+	checkRFC5424(t, msgs[0], "first line")
+	checkRFC5424(t, msgs[1], "second line")
+}
+
+// 生成localhost的自签名证书，返回服务端的tls配置和证书文件
+func selfSignedCert(t *testing.T) (*tls.Config, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, certFile
+}
+
+func TestRFC5424WriterTLS(t *testing.T) {
+	serverConfig, caFile := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	frames := acceptFrames(ln, 1)
+
+	writer, err := NewRFC5424Writer("app", "tls", ln.Addr().String(), map[string]string{
+		"tls_ca":          caFile,
+		"tls_server_name": "localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.SetPid(42)
+	_, _ = writer.Write([]byte("over tls\n"))
+	msgs := <-frames
+	_ = writer.Close()
+	if len(msgs) != 1 {
+		t.Fatalf("应该收到1条消息，得到%v", msgs)
+	}
+	checkRFC5424(t, msgs[0], "over tls")
+}
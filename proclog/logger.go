@@ -1,8 +1,8 @@
 package proclog
 
 import (
+	"fmt"
 	"io"
-	"strings"
 	"sync"
 )
 
@@ -16,7 +16,9 @@ type Logger interface {
 	ClearAllLogFile() error
 }
 
-// 创建日志对象
+// CreateLogger 创建日志对象，logFileName为日志输出的URL，根据URL的协议查找注册的构造函数，
+// 如file:///var/log/app.log、syslog://127.0.0.1:514?protocol=udp、ring://64KB，
+// 同时兼容/dev/stdout、syslog@host:port以及普通的文件路径等写法
 func CreateLogger(programName string,
 	logFileName string,
 	locker sync.Locker,
@@ -24,32 +26,22 @@ func CreateLogger(programName string,
 	backups int,
 	props map[string]string) Logger {
 
-	if logFileName == "/dev/stdout" {
-		return NewStdoutLogger()
-	}
-	if logFileName == "/dev/stderr" {
-		return NewStderrLogger()
-	}
-	if logFileName == "/dev/null" {
+	u, err := ParseLogURL(logFileName)
+	if err != nil {
+		fmt.Printf("Fail to parse log url --%s-- with error %v\n", logFileName, err)
 		return NewNullLogger()
 	}
-
-	if logFileName == "syslog" {
-		return NewSysLogger(programName, props)
-	}
-	if strings.HasPrefix(logFileName, "syslog") {
-		fields := strings.Split(logFileName, "@")
-		fields[0] = strings.TrimSpace(fields[0])
-		fields[1] = strings.TrimSpace(fields[1])
-		if len(fields) == 2 && fields[0] == "syslog" {
-			return NewRemoteSysLogger(programName, fields[1], props)
-		}
+	factory, ok := LookupSink(u.Scheme)
+	if !ok {
+		fmt.Printf("Unknown log sink scheme --%s-- in %s\n", u.Scheme, logFileName)
+		return NewNullLogger()
 	}
-
-	if len(logFileName) > 0 {
-		return NewFileLogger(logFileName, maxBytes, backups, locker)
+	lg, err := factory(programName, u, locker, maxBytes, backups, mergeProps(u, props))
+	if err != nil {
+		fmt.Printf("Fail to create log sink --%s-- with error %v\n", logFileName, err)
+		return NewNullLogger()
 	}
-	return NewNullLogger()
+	return lg
 }
 
 // NewLogger 新建日志对象
@@ -84,6 +76,42 @@ func NewLogger(programName string,
 	return NewCompositeLogger(loggers)
 }
 
+// 包含其他日志对象的日志类型
+type loggerContainer interface {
+	Loggers() []Logger
+}
+
+// Walk 深度优先遍历日志对象及其包含的所有日志对象，fn返回false时停止遍历
+func Walk(logger Logger, fn func(Logger) bool) bool {
+	if logger == nil {
+		return true
+	}
+	if !fn(logger) {
+		return false
+	}
+	if c, ok := logger.(loggerContainer); ok {
+		for _, l := range c.Loggers() {
+			if !Walk(l, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FindFileLogger 查找日志对象中的第一个文件日志
+func FindFileLogger(logger Logger) *FileLogger {
+	var fileLogger *FileLogger
+	Walk(logger, func(l Logger) bool {
+		if f, ok := l.(*FileLogger); ok {
+			fileLogger = f
+			return false
+		}
+		return true
+	})
+	return fileLogger
+}
+
 /*
 复合日志类型
 */
@@ -129,24 +157,43 @@ func (that *CompositeLogger) SetPid(pid int) {
 	}
 }
 
+// 获取第一个日志对象，所有日志对象都被移除后返回NullLogger
+func (that *CompositeLogger) first() Logger {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	if len(that.loggers) == 0 {
+		return NewNullLogger()
+	}
+	return that.loggers[0]
+}
+
 // ReadLog read log data from first logger in CompositeLogger pool
 func (that *CompositeLogger) ReadLog(offset int64, length int64) (string, error) {
-	return that.loggers[0].ReadLog(offset, length)
+	return that.first().ReadLog(offset, length)
 }
 
 // ReadTailLog tail the log data from first logger in CompositeLogger pool
 func (that *CompositeLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
-	return that.loggers[0].ReadTailLog(offset, length)
+	return that.first().ReadTailLog(offset, length)
 }
 
 // ClearCurLogFile clear the first logger file in CompositeLogger pool
 func (that *CompositeLogger) ClearCurLogFile() error {
-	return that.loggers[0].ClearCurLogFile()
+	return that.first().ClearCurLogFile()
 }
 
 // ClearAllLogFile clear all the files of first logger in CompositeLogger pool
 func (that *CompositeLogger) ClearAllLogFile() error {
-	return that.loggers[0].ClearAllLogFile()
+	return that.first().ClearAllLogFile()
+}
+
+// Loggers 获取CompositeLogger中的所有日志对象
+func (that *CompositeLogger) Loggers() []Logger {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	loggers := make([]Logger, len(that.loggers))
+	copy(loggers, that.loggers)
+	return loggers
 }
 
 func (that *CompositeLogger) AddLogger(logger Logger) {
@@ -155,15 +202,17 @@ func (that *CompositeLogger) AddLogger(logger Logger) {
 	that.loggers = append(that.loggers, logger)
 }
 
-func (that *CompositeLogger) RemoveLogger(logger Logger) {
+// RemoveLogger 移除日志对象，返回是否找到
+func (that *CompositeLogger) RemoveLogger(logger Logger) bool {
 	that.lock.Lock()
 	defer that.lock.Unlock()
 	for i, t := range that.loggers {
 		if t == logger {
 			that.loggers = append(that.loggers[:i], that.loggers[i+1:]...)
-			break
+			return true
 		}
 	}
+	return false
 }
 
 func NewCompositeLogger(loggers []Logger) *CompositeLogger {
@@ -0,0 +1,25 @@
+package proclog
+
+import (
+	"bytes"
+	"sync"
+)
+
+// 把写入的内容保存在内存中的日志对象
+type memLogger struct {
+	NullLogger
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (that *memLogger) Write(p []byte) (int, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.buf.Write(p)
+}
+
+func (that *memLogger) String() string {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.buf.String()
+}
@@ -0,0 +1,217 @@
+package proclog
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/moqsien/processes/utils"
+)
+
+// SinkFactory 日志输出的构造函数，u为日志的URL，URL中的query参数已经合并到props中
+type SinkFactory func(programName string,
+	u *url.URL,
+	locker sync.Locker,
+	maxBytes int64,
+	backups int,
+	props map[string]string) (Logger, error)
+
+var (
+	sinkLock  sync.RWMutex
+	sinkTable = make(map[string]SinkFactory)
+)
+
+// RegisterSink 注册日志输出的构造函数，scheme为URL的协议部分，如file、syslog，重复注册时会覆盖
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	sinkTable[strings.ToLower(scheme)] = factory
+}
+
+// LookupSink 查找已注册的日志输出构造函数
+func LookupSink(scheme string) (SinkFactory, bool) {
+	sinkLock.RLock()
+	defer sinkLock.RUnlock()
+	factory, ok := sinkTable[strings.ToLower(scheme)]
+	return factory, ok
+}
+
+func init() {
+	RegisterSink("null", func(_ string, _ *url.URL, _ sync.Locker, _ int64, _ int, _ map[string]string) (Logger, error) {
+		return NewNullLogger(), nil
+	})
+	RegisterSink("stdout", func(_ string, _ *url.URL, _ sync.Locker, _ int64, _ int, _ map[string]string) (Logger, error) {
+		return NewStdoutLogger(), nil
+	})
+	RegisterSink("stderr", func(_ string, _ *url.URL, _ sync.Locker, _ int64, _ int, _ map[string]string) (Logger, error) {
+		return NewStderrLogger(), nil
+	})
+	RegisterSink("file", newFileSink)
+	RegisterSink("ring", newRingSink)
+	RegisterSink("tcp", newNetSink)
+	RegisterSink("udp", newNetSink)
+	RegisterSink("unix", newNetSink)
+}
+
+// ParseLogURL 把日志文件名解析为URL，兼容以前的写法：
+//
+//	/dev/stdout、/dev/stderr、/dev/null
+//	syslog、syslog@[protocol:]host[:port]
+//	普通的文件路径
+//
+// 其他写法需要是scheme://...形式的URL，scheme没有通过RegisterSink注册时返回错误
+func ParseLogURL(logFileName string) (*url.URL, error) {
+	switch logFileName {
+	case "", "/dev/null":
+		return &url.URL{Scheme: "null"}, nil
+	case "/dev/stdout":
+		return &url.URL{Scheme: "stdout"}, nil
+	case "/dev/stderr":
+		return &url.URL{Scheme: "stderr"}, nil
+	case "syslog":
+		return &url.URL{Scheme: "syslog"}, nil
+	}
+	if strings.HasPrefix(logFileName, "syslog@") {
+		protocol, host, port, err := ParseSysLogConfig(strings.TrimSpace(strings.TrimPrefix(logFileName, "syslog@")))
+		if err != nil {
+			return nil, gerror.Wrapf(err, "syslog配置[%s]不合法", logFileName)
+		}
+		return &url.URL{
+			Scheme:   "syslog",
+			Host:     fmt.Sprintf("%s:%d", host, port),
+			RawQuery: url.Values{"protocol": []string{protocol}}.Encode(),
+		}, nil
+	}
+	if strings.Contains(logFileName, "://") {
+		u, err := url.Parse(logFileName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := LookupSink(u.Scheme); !ok {
+			return nil, gerror.Newf("日志输出[%s]的协议[%s]没有注册", logFileName, u.Scheme)
+		}
+		return u, nil
+	}
+	return &url.URL{Scheme: "file", Path: logFileName}, nil
+}
+
+// 合并URL的query参数和props，query参数优先
+func mergeProps(u *url.URL, props map[string]string) map[string]string {
+	merged := make(map[string]string, len(props))
+	for k, v := range props {
+		merged[k] = v
+	}
+	for k, v := range u.Query() {
+		if len(v) > 0 {
+			merged[k] = v[0]
+		}
+	}
+	return merged
+}
+
+// 从props中获取整数参数
+func propInt(props map[string]string, key string, defValue int) int {
+	if value, ok := props[key]; ok {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defValue
+}
+
+// 从props中获取容量参数，支持KB、MB、GB后缀
+func propBytes(props map[string]string, key string, defValue int) int {
+	if value, ok := props[key]; ok {
+		return utils.GetBytes(value, defValue)
+	}
+	return defValue
+}
+
+// 从props中获取八进制的文件权限参数，如0640
+func propMode(props map[string]string, key string, defValue uint32) uint32 {
+	if value, ok := props[key]; ok {
+		if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+			return uint32(mode)
+		}
+	}
+	return defValue
+}
+
+// 从props中获取布尔参数
+func propBool(props map[string]string, key string, defValue bool) bool {
+	if value, ok := props[key]; ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defValue
+}
+
+// file:///path/to/file.log?max_bytes=50MB&backups=10&timestamp=true&file_mode=0640&file_uid=1000&file_gid=1000&dir_mode=0750
+func newFileSink(_ string, u *url.URL, locker sync.Locker, maxBytes int64, backups int, props map[string]string) (Logger, error) {
+	path := fileURLPath(u)
+	if len(path) == 0 {
+		return nil, gerror.New("日志文件路径不能为空")
+	}
+	maxBytes = int64(propBytes(props, "max_bytes", int(maxBytes)))
+	backups = propInt(props, "backups", backups)
+	fileLogger := newFileLogger(path, maxBytes, backups, locker)
+	fileLogger.timestamp = propBool(props, "timestamp", false)
+	fileLogger.fileMode = os.FileMode(propMode(props, "file_mode", 0))
+	fileLogger.dirMode = os.FileMode(propMode(props, "dir_mode", 0755))
+	fileLogger.uid = propInt(props, "file_uid", -1)
+	fileLogger.gid = propInt(props, "file_gid", -1)
+	_ = fileLogger.OpenFile(false)
+	return fileLogger, nil
+}
+
+// 获取file://协议的文件路径
+func fileURLPath(u *url.URL) string {
+	if len(u.Host) > 0 { // file://relative/path.log
+		return u.Host + u.Path
+	}
+	return u.Path
+}
+
+// LogFilePaths 获取日志输出列表中所有写入本地文件的日志的路径
+func LogFilePaths(logFileNames string) []string {
+	paths := make([]string, 0)
+	for _, f := range SplitFileNames(logFileNames) {
+		u, err := ParseLogURL(f)
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		if path := fileURLPath(u); len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// ring://64KB 或者 ring://?size=64KB，不指定size时使用maxBytes
+func newRingSink(_ string, u *url.URL, _ sync.Locker, maxBytes int64, _ int, props map[string]string) (Logger, error) {
+	size := int(maxBytes)
+	if size <= 0 {
+		size = 1024 * 1024
+	}
+	if len(u.Host) > 0 {
+		size = utils.GetBytes(u.Host, size)
+	}
+	return NewRingLogger(propBytes(props, "size", size)), nil
+}
+
+// tcp://host:port、udp://host:port、unix:///path/to/socket?spool_dir=/var/spool/app
+func newNetSink(programName string, u *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+	addr := u.Host
+	if u.Scheme == "unix" {
+		addr = u.Path
+	}
+	if len(addr) == 0 {
+		return nil, gerror.Newf("日志输出[%s]的地址不能为空", u.String())
+	}
+	return NewNetLogger(u.Scheme, addr, NewSpoolFromProps(programName, u.Scheme+"://"+addr, props)), nil
+}
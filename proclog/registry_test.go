@@ -0,0 +1,78 @@
+package proclog
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestParseLogURL(t *testing.T) {
+	cases := []struct {
+		name   string
+		scheme string
+		host   string
+		path   string
+		query  string
+	}{
+		{"", "null", "", "", ""},
+		{"/dev/null", "null", "", "", ""},
+		{"/dev/stdout", "stdout", "", "", ""},
+		{"/dev/stderr", "stderr", "", "", ""},
+		{"syslog", "syslog", "", "", ""},
+		{"syslog@127.0.0.1", "syslog", "127.0.0.1:514", "", "protocol=udp"},
+		{"syslog@tcp:host", "syslog", "host:514", "", "protocol=tcp"},
+		{"syslog@tls:host", "syslog", "host:6514", "", "protocol=tls"},
+		{"syslog@host:1514", "syslog", "host:1514", "", "protocol=udp"},
+		{"syslog@tcp:host:1514", "syslog", "host:1514", "", "protocol=tcp"},
+		{"/var/log/app.log", "file", "", "/var/log/app.log", ""},
+		{"logs/app.log", "file", "", "logs/app.log", ""},
+		{"file:///var/log/app.log?backups=3", "file", "", "/var/log/app.log", "backups=3"},
+		{"syslog://127.0.0.1:514?protocol=udp", "syslog", "127.0.0.1:514", "", "protocol=udp"},
+		{"ring://64KB", "ring", "64KB", "", ""},
+		{"TCP://host:5000", "tcp", "host:5000", "", ""},
+	}
+	for _, c := range cases {
+		u, err := ParseLogURL(c.name)
+		if err != nil {
+			t.Fatalf("解析%q失败：%v", c.name, err)
+		}
+		if u.Scheme != c.scheme || u.Host != c.host || u.Path != c.path || u.RawQuery != c.query {
+			t.Fatalf("解析%q应该得到%s://%s%s?%s，得到%s://%s%s?%s", c.name,
+				c.scheme, c.host, c.path, c.query, u.Scheme, u.Host, u.Path, u.RawQuery)
+		}
+	}
+	for _, name := range []string{"unknown://host", "syslog@tcp:host:port", "syslog@a:b:c:d", "file://%zz"} {
+		if _, err := ParseLogURL(name); err == nil {
+			t.Fatalf("%q不合法，应该返回错误", name)
+		}
+	}
+}
+
+func TestRegisterSink(t *testing.T) {
+	var got *url.URL
+	var gotProps map[string]string
+	RegisterSink("Mem-Test", func(_ string, u *url.URL, _ sync.Locker, _ int64, _ int, props map[string]string) (Logger, error) {
+		got, gotProps = u, props
+		return &memLogger{}, nil
+	})
+	defer func() {
+		sinkLock.Lock()
+		delete(sinkTable, "mem-test")
+		sinkLock.Unlock()
+	}()
+
+	if _, ok := LookupSink("MEM-TEST"); !ok {
+		t.Fatalf("协议名称不应该区分大小写")
+	}
+	lg := CreateLogger("app", "mem-test://target?level=debug", NewNullLocker(), 0, 0, map[string]string{"level": "info", "extra": "1"})
+	if _, ok := lg.(*memLogger); !ok {
+		t.Fatalf("应该使用注册的构造函数创建日志，得到%T", lg)
+	}
+	if got.Host != "target" || gotProps["level"] != "debug" || gotProps["extra"] != "1" {
+		t.Fatalf("URL的query参数应该合并到props中并且优先，得到%s, %v", got, gotProps)
+	}
+	lg = CreateLogger("app", "unknown://target", NewNullLocker(), 0, 0, nil)
+	if _, ok := lg.(*NullLogger); !ok {
+		t.Fatalf("未注册的协议应该返回NullLogger，得到%T", lg)
+	}
+}
@@ -0,0 +1,268 @@
+package proclog
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// 队列文件头的长度，文件头保存已经重放的位置，重启后从该位置继续重放
+const spoolHeaderSize = 8
+
+// 单条记录的最大长度
+const spoolMaxRecord = 16 * 1024 * 1024
+
+// 队列文件已经被其他写入对象使用
+var errSpoolLocked = gerror.New("SPOOL_LOCKED")
+
+/*
+DiskSpool 有界的磁盘队列，远程日志不可用时暂存日志，恢复后按顺序重放
+文件格式: [8字节已重放位置][4字节长度+内容]...
+打开时对文件加排他锁，同一个队列文件同时只能被一个写入对象使用
+*/
+type DiskSpool struct {
+	lock     sync.Mutex
+	path     string
+	maxBytes int64 // 未重放内容的最大字节数，超出后丢弃新的日志
+	file     *os.File
+	readOff  int64 // 下一条要重放的记录的位置
+	size     int64 // 文件的长度
+	records  int64 // 未重放的记录数
+	dropped  int64 // 因为队列已满而丢弃的记录数
+}
+
+// 打开队列文件，恢复未重放的记录
+func (that *DiskSpool) open() error {
+	if err := os.MkdirAll(filepath.Dir(that.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(that.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	that.file = file
+	if err = lockSpoolFile(file); err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	that.size = info.Size()
+	if that.size < spoolHeaderSize {
+		return that.reset()
+	}
+	header := make([]byte, spoolHeaderSize)
+	if _, err = file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	that.readOff = int64(binary.BigEndian.Uint64(header))
+	if that.readOff < spoolHeaderSize || that.readOff > that.size {
+		return that.reset()
+	}
+	// 统计未重放的记录数，丢弃末尾不完整的记录
+	off := that.readOff
+	lenBuf := make([]byte, 4)
+	for off+4 <= that.size {
+		if _, err = file.ReadAt(lenBuf, off); err != nil {
+			return err
+		}
+		n := int64(binary.BigEndian.Uint32(lenBuf))
+		if off+4+n > that.size {
+			break
+		}
+		off += 4 + n
+		that.records++
+	}
+	if off < that.size {
+		that.size = off
+		return file.Truncate(off)
+	}
+	return nil
+}
+
+// 对队列文件加排他锁，文件已经被其他写入对象(如平滑重启时的新旧进程)使用时返回errSpoolLocked
+func lockSpoolFile(file *os.File) error {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return errSpoolLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// 清空队列文件
+func (that *DiskSpool) reset() error {
+	if err := that.file.Truncate(0); err != nil {
+		return err
+	}
+	that.size = spoolHeaderSize
+	that.records = 0
+	return that.writeReadOff(spoolHeaderSize)
+}
+
+func (that *DiskSpool) writeReadOff(off int64) error {
+	header := make([]byte, spoolHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(off))
+	if _, err := that.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	that.readOff = off
+	return nil
+}
+
+// Push 把一条记录加入队列，队列已满时丢弃该记录
+func (that *DiskSpool) Push(b []byte) error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	if that.size-that.readOff+4+int64(len(b)) > that.maxBytes || len(b) > spoolMaxRecord {
+		that.dropped++
+		return gerror.New("SPOOL_FULL")
+	}
+	record := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(record, uint32(len(b)))
+	copy(record[4:], b)
+	if _, err := that.file.WriteAt(record, that.size); err != nil {
+		that.dropped++
+		return err
+	}
+	that.size += int64(len(record))
+	that.records++
+	return nil
+}
+
+/*
+Requeue 把一组记录按顺序放到队列的开头，用于发送失败的记录：它们早于队列中已有的记录，需要先重放；
+队列的容量不足时丢弃放不下的记录
+*/
+func (that *DiskSpool) Requeue(records [][]byte) error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	remain := make([]byte, that.size-that.readOff)
+	if _, err := that.file.ReadAt(remain, that.readOff); err != nil {
+		return err
+	}
+	buf := make([]byte, 0)
+	count := int64(0)
+	for _, b := range records {
+		if int64(len(buf)+len(remain)+4+len(b)) > that.maxBytes || len(b) > spoolMaxRecord {
+			that.dropped++
+			continue
+		}
+		lenBuf := make([]byte, 4)
+		binary.BigEndian.PutUint32(lenBuf, uint32(len(b)))
+		buf = append(buf, lenBuf...)
+		buf = append(buf, b...)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	buf = append(buf, remain...)
+	if _, err := that.file.WriteAt(buf, spoolHeaderSize); err != nil {
+		return err
+	}
+	that.size = spoolHeaderSize + int64(len(buf))
+	if err := that.file.Truncate(that.size); err != nil {
+		return err
+	}
+	that.records += count
+	return that.writeReadOff(spoolHeaderSize)
+}
+
+// Peek 获取队列中最旧的记录，队列为空时返回io.EOF
+func (that *DiskSpool) Peek() ([]byte, error) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	if that.records == 0 {
+		return nil, io.EOF
+	}
+	lenBuf := make([]byte, 4)
+	if _, err := that.file.ReadAt(lenBuf, that.readOff); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(lenBuf))
+	if _, err := that.file.ReadAt(b, that.readOff+4); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Pop 移除队列中最旧的记录，队列为空或者已重放的部分过大时整理文件
+func (that *DiskSpool) Pop() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+
+	if that.records == 0 {
+		return nil
+	}
+	lenBuf := make([]byte, 4)
+	if _, err := that.file.ReadAt(lenBuf, that.readOff); err != nil {
+		return err
+	}
+	that.records--
+	off := that.readOff + 4 + int64(binary.BigEndian.Uint32(lenBuf))
+	if that.records == 0 {
+		return that.reset()
+	}
+	if off-spoolHeaderSize > that.maxBytes {
+		return that.compact(off)
+	}
+	return that.writeReadOff(off)
+}
+
+// 把未重放的记录移动到文件的开头
+func (that *DiskSpool) compact(off int64) error {
+	remain := make([]byte, that.size-off)
+	if _, err := that.file.ReadAt(remain, off); err != nil {
+		return err
+	}
+	if _, err := that.file.WriteAt(remain, spoolHeaderSize); err != nil {
+		return err
+	}
+	that.size = spoolHeaderSize + int64(len(remain))
+	if err := that.file.Truncate(that.size); err != nil {
+		return err
+	}
+	return that.writeReadOff(spoolHeaderSize)
+}
+
+// Stats 获取队列的状态
+func (that *DiskSpool) Stats() (records int64, bytes int64, dropped int64) {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.records, that.size - that.readOff, that.dropped
+}
+
+func (that *DiskSpool) Close() error {
+	that.lock.Lock()
+	defer that.lock.Unlock()
+	return that.file.Close()
+}
+
+// NewDiskSpool 打开或者创建磁盘队列，maxBytes为未重放内容的最大字节数
+func NewDiskSpool(path string, maxBytes int64) (*DiskSpool, error) {
+	if maxBytes <= 0 {
+		maxBytes = 64 * 1024 * 1024
+	}
+	spool := &DiskSpool{path: path, maxBytes: maxBytes}
+	if err := spool.open(); err != nil {
+		if spool.file != nil {
+			_ = spool.file.Close()
+		}
+		if err == errSpoolLocked {
+			return nil, err
+		}
+		return nil, gerror.Wrapf(err, "打开日志队列文件[%s]失败", path)
+	}
+	return spool, nil
+}
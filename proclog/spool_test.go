@@ -0,0 +1,105 @@
+package proclog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func popAll(t *testing.T, spool *DiskSpool) []string {
+	t.Helper()
+	records := make([]string, 0)
+	for {
+		b, err := spool.Peek()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(b))
+		if err = spool.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiskSpoolPushPeekPop(t *testing.T) {
+	spool, err := NewDiskSpool(filepath.Join(t.TempDir(), "app.spool"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = spool.Close() }()
+	for _, s := range []string{"a", "b", "c"} {
+		if err = spool.Push([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records, bytes, _ := spool.Stats(); records != 3 || bytes != 15 {
+		t.Fatalf("队列中应该有3条记录共15字节，得到%d条%d字节", records, bytes)
+	}
+	if err = spool.Requeue([][]byte{[]byte("x"), []byte("y")}); err != nil {
+		t.Fatal(err)
+	}
+	got := popAll(t, spool)
+	if want := []string{"x", "y", "a", "b", "c"}; len(got) != len(want) || got[0] != "x" || got[1] != "y" || got[4] != "c" {
+		t.Fatalf("放回开头的记录应该先重放，期望%v，得到%v", want, got)
+	}
+	if records, bytes, _ := spool.Stats(); records != 0 || bytes != 0 {
+		t.Fatalf("队列应该为空，得到%d条%d字节", records, bytes)
+	}
+}
+
+func TestDiskSpoolFull(t *testing.T) {
+	spool, err := NewDiskSpool(filepath.Join(t.TempDir(), "app.spool"), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = spool.Close() }()
+	_ = spool.Push([]byte("12345"))
+	if err = spool.Push([]byte("12345")); err == nil {
+		t.Fatal("队列已满时应该返回错误")
+	}
+	if _, _, dropped := spool.Stats(); dropped != 1 {
+		t.Fatalf("丢弃的记录数应该为1，得到%d", dropped)
+	}
+}
+
+func TestDiskSpoolRecoverAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.spool")
+	spool, err := NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"a", "b", "c"} {
+		_ = spool.Push([]byte(s))
+	}
+	_ = spool.Pop()
+	// 模拟管理进程在写入一条记录的过程中崩溃，文件末尾留下不完整的记录
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.Write([]byte{0, 0, 0, 9, 'x'})
+	_ = f.Close()
+	_ = spool.Close()
+
+	spool, err = NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = spool.Close() }()
+	if got := popAll(t, spool); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Fatalf("重新打开后应该从已重放的位置继续，并丢弃不完整的记录，得到%v", got)
+	}
+}
+
+func TestDiskSpoolLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.spool")
+	spool, err := NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = spool.Close() }()
+	if _, err = NewDiskSpool(path, 0); err != errSpoolLocked {
+		t.Fatalf("队列文件被使用时应该返回errSpoolLocked，得到%v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package proclog
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 重连的退避时间
+const (
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 60 * time.Second
+)
+
+// Close等待后台队列和磁盘队列写完的最长时间，超时后未写入的记录留在磁盘队列中
+var reliableCloseTimeout = 5 * time.Second
+
+// SpoolStats 远程日志的暂存状态
+type SpoolStats struct {
+	Connected bool  `json:"connected"` // 是否已连接到远程服务
+	Records   int64 `json:"records"`   // 暂存在磁盘队列中等待重放的记录数
+	Bytes     int64 `json:"bytes"`     // 暂存在磁盘队列中等待重放的字节数
+	Dropped   int64 `json:"dropped"`   // 丢弃的记录数
+}
+
+// SpoolReporter 可以获取暂存状态的日志对象
+type SpoolReporter interface {
+	SpoolStats() SpoolStats
+}
+
+/*
+ReliableWriter 在后台goroutine中写入远程日志，每次Write的内容作为一条记录写入。
+远程服务不可用或者写入失败时，记录暂存到磁盘队列中，按指数退避重连，连接恢复后按顺序重放。
+没有磁盘队列时，远程服务不可用期间的记录会被丢弃。
+
+记录的顺序：后台队列中的记录早于磁盘队列中的记录。开始暂存之后(spooling)，
+新的记录都直接写入磁盘队列，直到磁盘队列重放完毕；发送失败的记录连同后台队列中剩余的记录放回磁盘队列的开头
+*/
+type ReliableWriter struct {
+	dial       func() (io.WriteCloser, error)
+	spool      *DiskSpool
+	logChannel chan []byte
+	done       chan struct{}
+	stop       chan struct{} // Close超时后关闭，通知后台goroutine不再重放
+	lock       sync.RWMutex  // 保护closed，关闭logChannel时不能有正在进行的Write
+	closed     bool
+	orderLock  sync.Mutex // 保护spooling，保证记录进入后台队列和磁盘队列的顺序
+	spooling   bool       // 磁盘队列中有记录，新的记录需要写入磁盘队列
+	connected  int32
+	dropped    int64
+
+	writer   io.WriteCloser
+	backoff  time.Duration
+	nextDial time.Time
+}
+
+/*
+Write 把日志放入后台队列，调用方会复用p，所以需要复制一份；
+不会阻塞调用方(进程输出的管道)，后台队列已满或者磁盘队列中还有记录时写入磁盘队列，没有磁盘队列时丢弃
+*/
+func (that *ReliableWriter) Write(p []byte) (int, error) {
+	that.lock.RLock()
+	defer that.lock.RUnlock()
+	if that.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	that.orderLock.Lock()
+	defer that.orderLock.Unlock()
+	if that.spooling {
+		_ = that.spool.Push(b)
+		return len(p), nil
+	}
+	select {
+	case that.logChannel <- b:
+	default:
+		if that.spool == nil {
+			atomic.AddInt64(&that.dropped, 1)
+		} else {
+			that.spooling = true
+			_ = that.spool.Push(b)
+		}
+	}
+	return len(p), nil
+}
+
+// Close 停止后台写入，最多等待reliableCloseTimeout让队列中的日志写完，超时后剩余的日志留在磁盘队列中
+func (that *ReliableWriter) Close() error {
+	that.lock.Lock()
+	if !that.closed {
+		that.closed = true
+		close(that.logChannel)
+	}
+	that.lock.Unlock()
+	timer := time.NewTimer(reliableCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-that.done:
+	case <-timer.C:
+		// 后台goroutine可能正阻塞在连接或者写入上，通知它停止后不再等待，它会在返回后把剩余的记录留在磁盘队列中
+		that.orderLock.Lock()
+		select {
+		case <-that.stop:
+		default:
+			close(that.stop)
+		}
+		that.orderLock.Unlock()
+	}
+	return nil
+}
+
+// SpoolStats 获取暂存状态
+func (that *ReliableWriter) SpoolStats() SpoolStats {
+	stats := SpoolStats{
+		Connected: atomic.LoadInt32(&that.connected) == 1,
+		Dropped:   atomic.LoadInt64(&that.dropped),
+	}
+	if that.spool != nil {
+		records, bytes, dropped := that.spool.Stats()
+		stats.Records = records
+		stats.Bytes = bytes
+		stats.Dropped += dropped
+	}
+	return stats
+}
+
+// 连接远程服务，连接失败后按指数退避时间重试
+func (that *ReliableWriter) connect() bool {
+	if that.writer != nil {
+		return true
+	}
+	if time.Now().Before(that.nextDial) {
+		return false
+	}
+	writer, err := that.dial()
+	if err != nil || writer == nil {
+		if that.backoff == 0 {
+			that.backoff = reconnectMinBackoff
+		} else if that.backoff *= 2; that.backoff > reconnectMaxBackoff {
+			that.backoff = reconnectMaxBackoff
+		}
+		that.nextDial = time.Now().Add(that.backoff)
+		return false
+	}
+	that.writer = writer
+	that.backoff = 0
+	atomic.StoreInt32(&that.connected, 1)
+	return true
+}
+
+func (that *ReliableWriter) disconnect() {
+	if that.writer != nil {
+		_ = that.writer.Close()
+		that.writer = nil
+	}
+	atomic.StoreInt32(&that.connected, 0)
+}
+
+// 写入一条记录，失败时断开连接
+func (that *ReliableWriter) send(b []byte) bool {
+	if !that.connect() {
+		return false
+	}
+	if _, err := that.writer.Write(b); err != nil {
+		that.disconnect()
+		return false
+	}
+	return true
+}
+
+// 是否已经超时停止
+func (that *ReliableWriter) stopped() bool {
+	select {
+	case <-that.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 重放磁盘队列中的记录，全部重放完成时返回true，并结束暂存状态
+func (that *ReliableWriter) replay() bool {
+	if that.spool == nil {
+		return true
+	}
+	for !that.stopped() {
+		b, err := that.spool.Peek()
+		if err == io.EOF {
+			that.orderLock.Lock()
+			// Write在orderLock中写入磁盘队列，持有锁时队列仍然为空才能结束暂存
+			if records, _, _ := that.spool.Stats(); records == 0 {
+				that.spooling = false
+				that.orderLock.Unlock()
+				return true
+			}
+			that.orderLock.Unlock()
+			continue
+		}
+		if err != nil {
+			return false
+		}
+		if !that.send(b) {
+			return false
+		}
+		_ = that.spool.Pop()
+	}
+	return false
+}
+
+/*
+暂存发送失败的记录b(可以为nil)以及后台队列中剩余的记录，它们早于磁盘队列中已有的记录，放回磁盘队列的开头；
+之后的记录都写入磁盘队列，没有磁盘队列时丢弃
+*/
+func (that *ReliableWriter) hold(b []byte) {
+	if that.spool == nil {
+		if b != nil {
+			atomic.AddInt64(&that.dropped, 1)
+		}
+		return
+	}
+	that.orderLock.Lock()
+	defer that.orderLock.Unlock()
+	records := make([][]byte, 0, len(that.logChannel)+1)
+	if b != nil {
+		records = append(records, b)
+	}
+	for len(that.logChannel) > 0 {
+		c, ok := <-that.logChannel
+		if !ok {
+			break
+		}
+		records = append(records, c)
+	}
+	if len(records) > 0 {
+		that.spooling = true
+		_ = that.spool.Requeue(records)
+	}
+}
+
+func (that *ReliableWriter) start() {
+	go func() {
+		ticker := time.NewTicker(reconnectMinBackoff)
+		defer func() {
+			ticker.Stop()
+			that.disconnect()
+			if that.spool != nil {
+				_ = that.spool.Close()
+			}
+			close(that.done)
+		}()
+		for {
+			select {
+			case b, ok := <-that.logChannel:
+				if !ok {
+					// 已经关闭，尽量重放磁盘队列，超时后留给下一次打开队列的写入对象
+					that.replay()
+					return
+				}
+				if that.stopped() || !that.send(b) {
+					that.hold(b)
+				}
+				if that.stopped() {
+					that.hold(nil)
+					return
+				}
+				// 后台队列中的记录早于磁盘队列，后台队列为空时才重放
+				if len(that.logChannel) == 0 {
+					that.replay()
+				}
+			case <-ticker.C:
+				if len(that.logChannel) == 0 {
+					that.replay()
+				}
+			case <-that.stop:
+				that.hold(nil)
+				return
+			}
+		}
+	}()
+}
+
+// NewReliableWriter 创建可靠的后台写入对象，dial用于连接远程服务，spool为nil时不暂存
+func NewReliableWriter(dial func() (io.WriteCloser, error), spool *DiskSpool) *ReliableWriter {
+	writer := &ReliableWriter{
+		dial:       dial,
+		spool:      spool,
+		logChannel: make(chan []byte, 1024),
+		done:       make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+	// 上次遗留(如管理进程崩溃)的记录早于新的记录，先重放
+	if spool != nil {
+		if records, _, _ := spool.Stats(); records > 0 {
+			writer.spooling = true
+		}
+	}
+	writer.start()
+	return writer
+}
+
+var spoolNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+// 同一个队列同时被多个写入对象(如平滑重启时的新旧进程)使用时，最多尝试的队列文件数
+const spoolMaxSlots = 8
+
+// NewSpoolFromProps 根据props创建磁盘队列，没有设置spool_dir时返回nil
+//
+//	spool_dir: 队列文件存放的目录
+//	spool_max_bytes: 队列的最大容量，默认64MB
+//
+// 队列文件被其他写入对象加锁时，依次使用name.1.spool、name.2.spool...，遗留的队列文件由之后打开它的写入对象重放
+func NewSpoolFromProps(programName string, target string, props map[string]string) *DiskSpool {
+	dir, ok := props["spool_dir"]
+	if !ok || len(dir) == 0 {
+		return nil
+	}
+	sum := md5.Sum([]byte(target))
+	prefix := fmt.Sprintf("%s-%s-%s",
+		spoolNameRegex.ReplaceAllString(programName, "_"),
+		spoolNameRegex.ReplaceAllString(props["stream"], "_"),
+		hex.EncodeToString(sum[:4]))
+	maxBytes := int64(propBytes(props, "spool_max_bytes", 64*1024*1024))
+	for i := 0; i < spoolMaxSlots; i++ {
+		name := prefix + ".spool"
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d.spool", prefix, i)
+		}
+		spool, err := NewDiskSpool(filepath.Join(dir, name), maxBytes)
+		if err == errSpoolLocked {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Fail to open log spool with error %v\n", err)
+			return nil
+		}
+		return spool
+	}
+	fmt.Printf("Fail to open log spool --%s-- with error: all spool files are in use\n", prefix)
+	return nil
+}
@@ -0,0 +1,158 @@
+package proclog
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpoolFromPropsUsesSeparateFiles(t *testing.T) {
+	props := map[string]string{"spool_dir": t.TempDir(), "stream": "stdout"}
+	first := NewSpoolFromProps("app", "tcp://127.0.0.1:514", props)
+	second := NewSpoolFromProps("app", "tcp://127.0.0.1:514", props)
+	if first == nil || second == nil {
+		t.Fatal("应该能同时打开两个队列")
+	}
+	defer func() { _ = first.Close() }()
+	defer func() { _ = second.Close() }()
+	if first.path == second.path {
+		t.Fatalf("同时使用的队列不应该共用文件[%s]", first.path)
+	}
+}
+
+func TestReliableWriterDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	dial := func() (io.WriteCloser, error) {
+		<-release // 模拟连接远程服务时一直没有响应
+		return nil, io.ErrClosedPipe
+	}
+	writer := NewReliableWriter(dial, nil)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 4096; i++ {
+			_, _ = writer.Write([]byte("line\n"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("后台队列已满时Write不应该阻塞")
+	}
+	close(release)
+	_ = writer.Close()
+	if stats := writer.SpoolStats(); stats.Dropped == 0 {
+		t.Fatal("没有磁盘队列时，后台队列已满的记录应该被丢弃")
+	}
+	if _, err := writer.Write([]byte("late\n")); err != io.ErrClosedPipe {
+		t.Fatalf("关闭之后写入应该返回io.ErrClosedPipe，得到%v", err)
+	}
+}
+
+// 按顺序生成记录"rec-0\n"...
+func recordLines(from, to int) string {
+	var sb strings.Builder
+	for i := from; i < to; i++ {
+		sb.WriteString(fmt.Sprintf("rec-%d\n", i))
+	}
+	return sb.String()
+}
+
+func waitContent(t *testing.T, sink *memLogger, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for sink.String() != want {
+		if time.Now().After(deadline) {
+			got := sink.String()
+			t.Fatalf("远程服务应该按顺序收到%d字节，得到%d字节", len(want), len(got))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReliableWriterReplaysInOrder(t *testing.T) {
+	spool, err := NewDiskSpool(filepath.Join(t.TempDir(), "app.spool"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &memLogger{}
+	release := make(chan struct{})
+	attempts := int32(0)
+	dial := func() (io.WriteCloser, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			<-release // 第一次连接一直没有响应，然后失败
+			return nil, io.ErrClosedPipe
+		}
+		return sink, nil
+	}
+	writer := NewReliableWriter(dial, spool)
+	// 超过后台队列容量的记录写入磁盘队列
+	for i := 0; i < 3000; i++ {
+		_, _ = writer.Write([]byte(fmt.Sprintf("rec-%d\n", i)))
+	}
+	if stats := writer.SpoolStats(); stats.Records == 0 {
+		t.Fatal("后台队列已满时记录应该写入磁盘队列")
+	}
+	close(release)
+	waitContent(t, sink, recordLines(0, 3000))
+
+	// 磁盘队列重放完毕后，新的记录直接发送
+	_, _ = writer.Write([]byte("rec-3000\n"))
+	waitContent(t, sink, recordLines(0, 3001))
+	_ = writer.Close()
+	if stats := writer.SpoolStats(); stats.Records != 0 || stats.Dropped != 0 {
+		t.Fatalf("所有记录都应该已经发送，得到%+v", stats)
+	}
+}
+
+func TestReliableWriterRecoversLeftoverSpool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.spool")
+	spool, err := NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上次运行的管理进程崩溃时遗留在磁盘队列中的记录
+	for i := 0; i < 3; i++ {
+		_ = spool.Push([]byte(fmt.Sprintf("rec-%d\n", i)))
+	}
+	_ = spool.Close()
+
+	spool, err = NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &memLogger{}
+	writer := NewReliableWriter(func() (io.WriteCloser, error) { return sink, nil }, spool)
+	_, _ = writer.Write([]byte("rec-3\n"))
+	waitContent(t, sink, recordLines(0, 4))
+	_ = writer.Close()
+}
+
+func TestReliableWriterCloseTimeout(t *testing.T) {
+	old := reliableCloseTimeout
+	reliableCloseTimeout = 200 * time.Millisecond
+	defer func() { reliableCloseTimeout = old }()
+
+	path := filepath.Join(t.TempDir(), "app.spool")
+	spool, err := NewDiskSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	writer := NewReliableWriter(func() (io.WriteCloser, error) {
+		<-release // 远程服务一直没有响应
+		return nil, io.ErrClosedPipe
+	}, spool)
+	_, _ = writer.Write([]byte("rec-0\n"))
+
+	start := time.Now()
+	_ = writer.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Close应该在超时后返回，用时%v", elapsed)
+	}
+}
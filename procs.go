@@ -28,11 +28,25 @@ type ProcessPlus struct {
 	RetryTimes  *int32    // 启动重试的次数
 	StartTime   time.Time // 启动时间
 	StopTime    time.Time // 停止时间
+	Program     string    // 所属的程序名称，NumProcs大于1时有多个进程实例属于同一个程序
+	ProcessNum  int       // 在所属程序中的序号
 
 	Lock      sync.RWMutex
 	Stdin     io.WriteCloser
 	StdoutLog proclog.Logger
 	StderrLog proclog.Logger
+
+	stdoutRedactor *proclog.RedactFilter     // 标准输出脱敏过滤器
+	stderrRedactor *proclog.RedactFilter     // 标准错误脱敏过滤器
+	stdoutLimiter  *proclog.RateLimitFilter  // 标准输出限流过滤器
+	stderrLimiter  *proclog.RateLimitFilter  // 标准错误限流过滤器
+	logSinks       map[string]proclog.Logger // 配置的每个日志输出对应的日志对象，key为"stream|日志输出"
+	launch         *launchCmd                // 不为nil表示启动命令已经添加了监听socket，保存的是原来的启动命令
+	ready          *readyGate                // 本次启动的就绪信号
+	notify         *notifySocket             // sd_notify协议的NOTIFY_SOCKET
+	notifyStatus   string                    // 进程通过STATUS=通知的状态文本
+	mainPid        int32                     // 进程通过MAINPID=通知的主进程pid，fork类型的守护进程使用
+	template       *ProcessPlus              // 展开名称等模板之前的进程，单进程伸缩为程序时作为创建进程实例的模板
 }
 
 // NewProcess 创建进程: path, 可执行文件绝对路径；name, 进程名称
@@ -49,15 +63,55 @@ func NewProcess(path, name string) (p *ProcessPlus) {
 		Pdeathsig: syscall.SIGKILL,
 	}
 	p.RetryTimes = new(int32)
+	p.State = Stopped
 	return
 }
 
+// 重新创建exec.Cmd，exec.Cmd只能启动一次，进程退出后再次启动时需要新的exec.Cmd
+func (that *ProcessPlus) resetCmd() {
+	cmd := &exec.Cmd{
+		Path:       that.Path,
+		Args:       that.Args,
+		Dir:        that.Dir,
+		ExtraFiles: that.ExtraFiles,
+		SysProcAttr: &syscall.SysProcAttr{
+			Setpgid:   true,
+			Pdeathsig: syscall.SIGKILL,
+		},
+	}
+	that.Cmd = cmd
+}
+
+/*
+Init 在每次启动前初始化启动命令、环境变量和日志；
+进程的环境变量为管理进程的环境变量加上Environment，不会修改管理进程自身的环境变量，
+所以一个进程的Environment不会泄漏到之后启动的其他进程中
+*/
 func (that *ProcessPlus) Init() (err error) {
-	// 设置进程运行的环境变量
-	if that.Environment.Size() > 0 {
-		_ = genv.SetMap(that.Environment.Map())
+	that.restoreLaunch()
+	if that.Process != nil {
+		that.resetCmd()
 	}
+
+	// 设置进程运行的环境变量，在管理进程的环境变量之后追加，同名的环境变量以后面的为准，不修改管理进程自身的环境变量
 	that.Env = genv.All()
+	that.Environment.Iterator(func(k string, v string) bool {
+		that.Env = append(that.Env, k+"="+v)
+		return true
+	})
+
+	// 传递管理器持有的监听socket
+	if err = that.applyListeners(); err != nil {
+		return
+	}
+
+	// 就绪信号和sd_notify的NOTIFY_SOCKET
+	that.ready = newReadyGate()
+	that.notifyStatus = ""
+	atomic.StoreInt32(&that.mainPid, 0)
+	if err = that.openNotify(); err != nil {
+		return
+	}
 
 	// 设置程序运行时用户
 	if that.SetUser() != nil {
@@ -80,14 +134,18 @@ func (that *ProcessPlus) Init() (err error) {
 	return
 }
 
-// Clone 克隆进程
+// Clone 克隆进程，复制配置、启动命令和ExtraFiles，克隆出的进程还没有初始化，日志等在启动(RunProc)时由Init创建
 func (that *ProcessPlus) Clone() (IProc, error) {
-	proc := NewProcess(that.Path, that.Name)
+	path, args, extraFiles := that.command()
+	proc := NewProcess(path, that.Name)
 	proc.ProcManager = that.ProcManager
+	proc.Program = that.Program
+	proc.ProcessNum = that.ProcessNum
 
-	proc.ProcSettings = &(*that.ProcSettings)
-	proc.ProcSettings.Environment = proc.ProcSettings.Environment.Clone()
-	proc.ProcSettings.Extend = proc.ProcSettings.Extend.Clone()
+	proc.ProcSettings = that.ProcSettings.Clone()
+	proc.Args = append([]string(nil), args...)
+	proc.Dir = that.Dir
+	proc.ExtraFiles = extraFiles
 
 	proc.StartTime = time.Unix(0, 0)
 	proc.StopTime = time.Unix(0, 0)
@@ -95,7 +153,6 @@ func (that *ProcessPlus) Clone() (IProc, error) {
 	proc.Starting = false
 	proc.StopByUser = false
 	proc.RetryTimes = new(int32)
-	proc.Init()
 	return proc, nil
 }
 
@@ -115,6 +172,43 @@ func (that *ProcessPlus) MonitorProgramIsRunning(endTime time.Time, monitorExite
 	}
 }
 
+/*
+等待进程的就绪信号(如sd_notify的READY=1)，收到信号时修改State为Running，
+超过ReadyTimeoutSecs没有就绪时强制结束进程，按启动失败处理，受StartRetries限制
+*/
+func (that *ProcessPlus) MonitorProgramIsReady(gate *readyGate, monitorExited *int32, programExited *int32) {
+	defer atomic.StoreInt32(monitorExited, 1)
+	timeout := time.Duration(that.ReadyTimeoutSecs) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gate.ch:
+			that.Lock.Lock()
+			if atomic.LoadInt32(programExited) == 0 && that.State == Starting {
+				logger.Infof("进程[%s]已经就绪，启动成功", that.Name)
+				that.State = Running
+			}
+			that.Lock.Unlock()
+			return
+		case <-timer.C:
+			// 启动失败的进程不应该留下子进程，否则子进程持有的输出管道会让Wait一直阻塞
+			logger.Errorf("等待进程[%s]就绪超时(%v)，强制结束进程组", that.Name, timeout)
+			_ = that.Signal(syscall.SIGKILL, true)
+			return
+		case <-ticker.C:
+			if atomic.LoadInt32(programExited) != 0 {
+				return
+			}
+		}
+	}
+}
+
 // 设置程序启动失败状态
 func (that *ProcessPlus) FailToStartProgram(reason string, finishCb func()) {
 	logger.Errorf("程序[%s]启动失败，失败原因：%s ", that.Name, reason)
@@ -155,6 +249,9 @@ func (that *ProcessPlus) GetExitCode() (int, error) {
 
 // 判断进程是否在运行
 func (that *ProcessPlus) IsRunning() bool {
+	if pid := atomic.LoadInt32(&that.mainPid); pid > 0 {
+		return signals.CheckPidExist(int(pid))
+	}
 	if that.Cmd != nil && that.Process != nil {
 		if runtime.GOOS == "windows" {
 			proc, err := os.FindProcess(that.Process.Pid)
@@ -189,6 +286,9 @@ func (that *ProcessPlus) IsAutoRestart() bool {
 // 阻塞等待进程运行结束
 func (that *ProcessPlus) WaitForExit(_ int64) {
 	_ = that.Wait()
+	// fork类型的守护进程通过MAINPID=通知了新的主进程时，等待新的主进程退出
+	that.waitMainPid()
+	that.closeNotify()
 	// 进程退出后执行
 	if that.ProcessState != nil {
 		logger.Infof("程序[%s]已经结束运行，退出码为:%v", that.Name, that.ProcessState)
@@ -196,15 +296,16 @@ func (that *ProcessPlus) WaitForExit(_ int64) {
 		logger.Infof("程序[%s]已经结束运行", that.Name)
 	}
 	that.Lock.Lock()
-	defer that.Lock.Unlock()
 	that.StopTime = time.Now()
+	stdoutLog, stderrLog := that.StdoutLog, that.StderrLog
+	that.Lock.Unlock()
 
-	// 关闭标准输出
-	if that.StdoutLog != nil {
-		_ = that.StdoutLog.Close()
+	// 关闭标准输出，远程日志关闭时需要发送剩余的日志，不能持有进程锁，以免阻塞查询进程状态
+	if stdoutLog != nil {
+		_ = stdoutLog.Close()
 	}
-	if that.StderrLog != nil {
-		_ = that.StderrLog.Close()
+	if stderrLog != nil {
+		_ = stderrLog.Close()
 	}
 }
 
@@ -355,10 +456,17 @@ func (that *ProcessPlus) RunProc(finishCb func()) {
 
 		monitorExited := int32(0)
 		programExited := int32(0)
-		// 如果未设置启动监视时长，则表示cmd.start成功就算该程序启动成功
-		if startSecs <= 0 {
+		// 设置了就绪信号时，收到信号才算启动成功，否则按StartSecs判断
+		if that.readyGated() {
+			gate := that.ready
+			go func() {
+				that.MonitorProgramIsReady(gate, &monitorExited, &programExited)
+				finishCbWrapper()
+			}()
+		} else if startSecs <= 0 { // 如果未设置启动监视时长，则表示cmd.start成功就算该程序启动成功
 			logger.Infof("程序[%s]启动成功", that.Name)
 			that.State = Running
+			atomic.StoreInt32(&monitorExited, 1) // 没有监控goroutine
 			go finishCbWrapper()
 		} else {
 			go func() { // 异步监控进程是否成功运行
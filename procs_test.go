@@ -0,0 +1,62 @@
+package processes
+
+import (
+	"testing"
+	"time"
+)
+
+// 等待进程进入指定状态
+func waitProcState(t *testing.T, p *ProcessPlus, state ProcState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.Lock.RLock()
+		current := p.State
+		p.Lock.RUnlock()
+		if current == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("进程[%s]应该进入%s状态，当前状态为%s", p.Name, state.ToString(), current.ToString())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestProcessRestart(t *testing.T) {
+	p, err := NewManager().NewProcess("restart-test",
+		ProcPath("/bin/sleep"),
+		ProcArgs([]string{"10"}),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStartSecs(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.StartProc(true)
+	waitProcState(t, p, Running)
+	firstPid := p.Pid()
+	p.StopProc(true)
+
+	// exec.Cmd只能启动一次，再次启动时需要重新创建
+	p.StartProc(true)
+	defer p.StopProc(true)
+	waitProcState(t, p, Running)
+	if pid := p.Pid(); pid == 0 || pid == firstPid {
+		t.Fatalf("重新启动后应该是新的进程，第一次的pid为%d，得到%d", firstPid, pid)
+	}
+}
+
+func TestProcessExitsWithoutStartSecs(t *testing.T) {
+	p, err := NewManager().NewProcess("startsecs-test",
+		ProcPath("/bin/true"),
+		ProcAutoReStart(AutoReStartFalse),
+		ProcStartSecs(0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// startsecs为0时没有监控goroutine，进程退出后不应该一直等待它
+	p.StartProc(true)
+	waitProcState(t, p, Exited)
+}
@@ -2,8 +2,11 @@ package processes
 
 import (
 	"os"
+	"regexp"
 
 	"github.com/gogf/gf/container/gmap"
+	"github.com/moqsien/processes/logger"
+	"github.com/moqsien/processes/proclog"
 	"github.com/moqsien/processes/utils"
 )
 
@@ -18,7 +21,7 @@ type ProcSettings struct {
 	RestartPause          int         // 进程重启间隔秒数，默认是0，表示不间隔
 	User                  string      // 用哪个用户启动进程，默认是父进程的所属用户
 	Priority              int         // 进程启动优先级，默认999，值小的优先启动
-	StdoutLogfile         string      // 日志文件，需要注意当指定目录不存在时无法正常启动，所以需要手动创建目录（supervisord 会自动创建日志文件）
+	StdoutLogfile         string      // 日志文件，目录不存在时按LogDirMode自动创建
 	StdoutLogFileMaxBytes int         // stdout 日志文件大小，默认50MB
 	StdoutLogFileBackups  int         // stdout 日志文件备份数，默认是10
 	RedirectStderr        bool        // 把stderr重定向到stdout，默认false
@@ -33,6 +36,60 @@ type ProcSettings struct {
 	KillWaitSecs             int             // 强制杀死进程等待秒数
 	RestartWhenBinaryChanged bool            // 当进程的二进制文件有修改，是否需要重启,默认false
 	Extend                   *gmap.AnyAnyMap // 扩展参数
+
+	LogTimestamp     bool                  // 是否在写入日志文件的每一行前添加时间戳，开启后可以按时间范围读取日志，默认false
+	LogRedactBuiltin bool                  // 是否启用内置的日志脱敏规则(bearer token、AWS key、URL中的密码等)，默认false
+	LogRedactRules   []*proclog.RedactRule // 自定义的日志脱敏规则，在日志写入任何输出之前执行
+
+	LogRateLimitLines    int // 标准输出和标准错误各自每秒最多写入的日志行数，0表示不限制
+	LogRateLimitBytes    int // 标准输出和标准错误各自每秒最多写入的日志字节数，0表示不限制
+	LogRateLimitInterval int // 限流时写入"N lines suppressed"汇总行的间隔秒数，默认10秒
+
+	LogFileMode  os.FileMode // 日志文件的权限，如0640，0表示使用0666(受umask影响)
+	LogFileOwner string      // 日志文件的所属用户(用户名或者uid)，为空表示不修改
+	LogFileGroup string      // 日志文件的所属组(组名或者gid)，为空时使用LogFileOwner的默认组
+	LogDirMode   os.FileMode // 日志目录不存在时自动创建，创建时使用的权限，默认0755
+
+	NumProcs      int    // 同一个程序启动的进程实例数，默认1
+	NumProcsStart int    // 进程实例的起始序号，默认0
+	ProcessName   string // 进程实例的名称模板，如worker_%(process_num)02d，NumProcs大于1时默认为%(program_name)s_%(process_num)02d
+	NumProcsMin   int    // 伸缩时的最小进程实例数，默认0
+	NumProcsMax   int    // 伸缩时的最大进程实例数，0表示不限制
+
+	Group  string          // 所属的进程组，可以通过"组名:*"对整个组进行操作
+	Labels *gmap.StrStrMap // 进程的标签，可以通过标签选择器(如@team=payments,tier!=canary)批量操作进程
+
+	ReadyProbe       ReadyProbe     // 就绪探针，滚动重启等操作在进程进入Running状态后还需要等待探针检查通过
+	ReadyPattern     *regexp.Regexp // 标准输出或者标准错误有一行匹配该正则时，进程才从Starting变为Running，不再使用StartSecs
+	ReadyTimeoutSecs int            // 等待进程就绪的最长秒数，默认60秒，ReadyPattern和sd_notify超时按启动失败处理
+
+	ReloadOverlapSecs int // 平滑重启时新进程就绪后，新旧进程同时运行的秒数，之后再停止原进程，默认0
+
+	Listeners    []*ListenerSpec // 由管理器持有的监听socket，按LISTEN_FDS的约定从fd 3开始传递给子进程
+	OnDemand     bool            // 按需启动：管理器在Listeners上等待连接，收到第一个连接时才启动进程，默认false
+	IdleStopSecs int             // 按需启动的进程持续没有连接超过该秒数时停止进程，0表示不停止
+
+	Notify       bool // 启用sd_notify协议：进程通过NOTIFY_SOCKET发送READY=1后才从Starting变为Running，不再使用StartSecs
+	WatchdogSecs int  // sd_notify的看门狗超时秒数，进程需要按时发送WATCHDOG=1，超时后结束进程并按自动重启规则重启，0表示不启用
+}
+
+// Clone 深拷贝进程配置
+func (that *ProcSettings) Clone() *ProcSettings {
+	settings := *that
+	if that.Environment != nil {
+		settings.Environment = that.Environment.Clone()
+	}
+	if that.Extend != nil {
+		settings.Extend = that.Extend.Clone()
+	}
+	if that.Labels != nil {
+		settings.Labels = that.Labels.Clone()
+	}
+	settings.ExitCodes = append([]int(nil), that.ExitCodes...)
+	settings.StopSignal = append([]string(nil), that.StopSignal...)
+	settings.LogRedactRules = append([]*proclog.RedactRule(nil), that.LogRedactRules...)
+	settings.Listeners = append([]*ListenerSpec(nil), that.Listeners...)
+	return &settings
 }
 
 /*
@@ -224,6 +281,27 @@ func ProcUser(user string) Option {
 // 	that.User = user
 // }
 
+// ProcGroup 设置进程所属的进程组，进程组不存在时按默认优先级999创建
+func ProcGroup(group string) Option {
+	return func(p *ProcessPlus) {
+		p.Group = group
+	}
+}
+
+// ProcLabel 设置进程的标签
+func ProcLabel(key, value string) Option {
+	return func(p *ProcessPlus) {
+		p.Labels.Set(key, value)
+	}
+}
+
+// ProcLabels 设置进程的标签，通过map的方式
+func ProcLabels(labels map[string]string) Option {
+	return func(p *ProcessPlus) {
+		p.Labels.Sets(labels)
+	}
+}
+
 // SetProcPriority 设置进程启动优先级，默认999，值小的优先启动
 func ProcPriority(pri int) Option {
 	return func(p *ProcessPlus) {
@@ -322,6 +400,176 @@ func ProcStderrLog(file, maxBytes string, backups ...int) Option {
 // 	}
 // }
 
+// ProcLogTimestamp 设置是否在日志文件的每一行前添加时间戳
+func ProcLogTimestamp(enable bool) Option {
+	return func(p *ProcessPlus) {
+		p.LogTimestamp = enable
+	}
+}
+
+// ProcLogRedactBuiltin 启用内置的日志脱敏规则
+func ProcLogRedactBuiltin(enable bool) Option {
+	return func(p *ProcessPlus) {
+		p.LogRedactBuiltin = enable
+	}
+}
+
+// ProcLogRedactRule 添加名称为name的日志脱敏规则，命中pattern的内容替换为replace，replace为空时替换为[REDACTED]
+func ProcLogRedactRule(name, pattern, replace string) Option {
+	return func(p *ProcessPlus) {
+		rule, err := proclog.NewRedactRule(name, pattern, replace)
+		if err != nil {
+			logger.Errorf("进程[%s]的日志脱敏规则无效,err:%v", p.Name, err)
+			return
+		}
+		p.LogRedactRules = append(p.LogRedactRules, rule)
+	}
+}
+
+// ProcLogRateLimit 设置日志限流，lines为每秒行数，bytes为每秒字节数(支持KB、MB后缀)，0或者空表示不限制
+func ProcLogRateLimit(lines int, bytes string, intervalSecs ...int) Option {
+	return func(p *ProcessPlus) {
+		p.LogRateLimitLines = lines
+		p.LogRateLimitBytes = utils.GetBytes(bytes, 0)
+		if len(intervalSecs) > 0 {
+			p.LogRateLimitInterval = intervalSecs[0]
+		}
+	}
+}
+
+// ProcLogFileMode 设置日志文件的权限，如0640
+func ProcLogFileMode(mode os.FileMode) Option {
+	return func(p *ProcessPlus) {
+		p.LogFileMode = mode
+	}
+}
+
+// ProcLogFileOwner 设置日志文件的所属用户和组，group为空时使用owner的默认组
+func ProcLogFileOwner(owner, group string) Option {
+	return func(p *ProcessPlus) {
+		p.LogFileOwner = owner
+		p.LogFileGroup = group
+	}
+}
+
+// ProcLogDirMode 设置自动创建日志目录时使用的权限，如0750
+func ProcLogDirMode(mode os.FileMode) Option {
+	return func(p *ProcessPlus) {
+		p.LogDirMode = mode
+	}
+}
+
+/*
+ProcNumProcs 设置同一个程序启动的进程实例数，nameTemplate为进程实例的名称模板，
+模板中可以使用%(program_name)s和%(process_num)d(支持02d等格式)，NumProcs大于1时必须包含%(process_num)，
+参数、环境变量和日志文件中的模板会按每个实例展开
+*/
+func ProcNumProcs(n int, nameTemplate ...string) Option {
+	return func(p *ProcessPlus) {
+		p.NumProcs = n
+		if len(nameTemplate) > 0 {
+			p.ProcessName = nameTemplate[0]
+		}
+	}
+}
+
+// ProcNumProcsBounds 设置Manager.Scale伸缩时进程实例数的范围，max为0表示不限制
+func ProcNumProcsBounds(min, max int) Option {
+	return func(p *ProcessPlus) {
+		p.NumProcsMin = min
+		p.NumProcsMax = max
+	}
+}
+
+// ProcNumProcsStart 设置进程实例的起始序号
+func ProcNumProcsStart(start int) Option {
+	return func(p *ProcessPlus) {
+		p.NumProcsStart = start
+	}
+}
+
+// ProcReadyProbe 设置就绪探针，如TCPProbe、HTTPProbe、ExecProbe，timeoutSecs为等待进程就绪的最长秒数
+func ProcReadyProbe(probe ReadyProbe, timeoutSecs ...int) Option {
+	return func(p *ProcessPlus) {
+		p.ReadyProbe = probe
+		if len(timeoutSecs) > 0 {
+			p.ReadyTimeoutSecs = timeoutSecs[0]
+		}
+	}
+}
+
+// ProcReloadOverlapSecs 设置平滑重启时新进程就绪后，新旧进程同时运行的秒数
+func ProcReloadOverlapSecs(t int) Option {
+	return func(p *ProcessPlus) {
+		p.ReloadOverlapSecs = t
+	}
+}
+
+/*
+ProcListener 声明由管理器持有的监听socket，address如tcp://:8080、unix:///run/app.sock，backlog为0时使用系统默认值；
+子进程通过LISTEN_FDS、LISTEN_FDNAMES和LISTEN_PID(systemd的约定)获取socket，平滑重启时新旧进程共享同一个socket
+*/
+func ProcListener(name, address string, backlog ...int) Option {
+	return func(p *ProcessPlus) {
+		network, addr, err := parseListenAddress(address)
+		if err != nil {
+			logger.Errorf("进程[%s]的监听socket[%s]无效,err:%v", p.Name, name, err)
+			return
+		}
+		spec := &ListenerSpec{Name: name, Network: network, Address: addr}
+		if len(backlog) > 0 {
+			spec.Backlog = backlog[0]
+		}
+		p.Listeners = append(p.Listeners, spec)
+	}
+}
+
+/*
+ProcOnDemand 设置进程按需启动(类似inetd)，需要同时通过ProcListener声明监听socket，
+Manager.StartAllProcs或者StartOnDemand之后管理器等待连接，收到第一个连接时启动进程并由进程accept，
+idleStopSecs大于0时，进程持续没有连接超过该秒数就停止进程，之后重新等待连接
+*/
+func ProcOnDemand(idleStopSecs ...int) Option {
+	return func(p *ProcessPlus) {
+		p.OnDemand = true
+		if len(idleStopSecs) > 0 {
+			p.IdleStopSecs = idleStopSecs[0]
+		}
+	}
+}
+
+/*
+ProcReadyPattern 设置就绪规则：进程的标准输出或者标准错误有一行匹配pattern(如"listening on .*:8080")时才算启动成功，
+timeoutSecs为等待匹配的最长秒数，超时后结束进程并按启动失败处理，受StartRetries限制
+*/
+func ProcReadyPattern(pattern string, timeoutSecs ...int) Option {
+	return func(p *ProcessPlus) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Errorf("进程[%s]的就绪规则无效,err:%v", p.Name, err)
+			return
+		}
+		p.ReadyPattern = re
+		if len(timeoutSecs) > 0 {
+			p.ReadyTimeoutSecs = timeoutSecs[0]
+		}
+	}
+}
+
+/*
+ProcNotify 启用sd_notify协议：管理器为进程创建NOTIFY_SOCKET，进程发送READY=1后才算启动成功，
+超过ReadyTimeoutSecs没有就绪按启动失败处理；STATUS=的内容显示在Info.Description中，MAINPID=用于fork类型的守护进程；
+watchdogSecs大于0时设置WATCHDOG_USEC，进程没有按时发送WATCHDOG=1时结束进程并重启
+*/
+func ProcNotify(watchdogSecs ...int) Option {
+	return func(p *ProcessPlus) {
+		p.Notify = true
+		if len(watchdogSecs) > 0 {
+			p.WatchdogSecs = watchdogSecs[0]
+		}
+	}
+}
+
 // 进程默认配置
 func GetDefaultProcSettings() *ProcSettings {
 	return &ProcSettings{
@@ -338,6 +586,7 @@ func GetDefaultProcSettings() *ProcSettings {
 		RestartWhenBinaryChanged: false,
 		Extend:                   gmap.New(true),
 		Environment:              gmap.NewStrStrMap(true),
+		Labels:                   gmap.NewStrStrMap(true),
 		StdoutLogfile:            "",
 		StdoutLogFileMaxBytes:    50 * 1024 * 1024,
 		StdoutLogFileBackups:     10,
@@ -345,6 +594,10 @@ func GetDefaultProcSettings() *ProcSettings {
 		StderrLogfile:            "",
 		StderrLogFileMaxBytes:    50 * 1024 * 1024,
 		StderrLogFileBackups:     10,
+		LogRateLimitInterval:     10,
+		LogDirMode:               0755,
+		NumProcs:                 1,
+		ReadyTimeoutSecs:         60,
 		//User:                     "root",
 	}
 }
@@ -83,7 +83,8 @@ func KillPid(pid int, sig os.Signal, sigChildren ...bool) error {
 	return syscall.Kill(pid, localSig)
 }
 
-// 检查进程是否存在
-func CheckPidExist(_ int) bool {
-	return false
+// CheckPidExist 检查进程是否存在，没有权限向进程发送信号(EPERM)时进程也是存在的
+func CheckPidExist(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
 }
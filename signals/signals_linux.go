@@ -84,11 +84,8 @@ func KillPid(pid int, sig os.Signal, sigChildren ...bool) error {
 	return syscall.Kill(pid, localSig)
 }
 
-// CheckPidExist 检查进程是否存在
+// CheckPidExist 检查进程是否存在，没有权限向进程发送信号(EPERM)时进程也是存在的
 func CheckPidExist(pid int) bool {
 	err := syscall.Kill(pid, 0)
-	if err != nil && err.Error() != "no such process" {
-		return true
-	}
-	return false
+	return err == nil || err == syscall.EPERM
 }